@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// AclRule allows the clients with one of its roles or identities to make requests with its methods
+// to the paths matching its globs. Access to a path includes everything beneath it.
+type AclRule struct {
+	Roles      []string `json:"roles,omitempty"`      // Roles the rule applies to
+	Identities []string `json:"identities,omitempty"` // Names of API keys or client certificates, or JWT subjects
+	Methods    []string `json:"methods,omitempty"`    // HTTP methods allowed by the rule, or all if empty or "*"
+	Paths      []string `json:"paths"`                // Globs of request paths, e.g. "/model/setpoints/**"
+}
+
+// appliesTo reports whether the rule grants anything to the principal
+func (rule AclRule) appliesTo(principal *Principal) bool {
+	for _, identity := range rule.Identities {
+		if identity == principal.Name {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		for _, granted := range principal.Roles {
+			if role == granted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether the rule allows requests with the method
+func (rule AclRule) allowsMethod(method string) bool {
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, allowed := range rule.Methods {
+		if allowed == "*" || strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAcl checks the syntax of the rules' globs
+func validateAcl(rules []AclRule) error {
+	for i, rule := range rules {
+		if len(rule.Roles) == 0 && len(rule.Identities) == 0 {
+			return fmt.Errorf("rule %d needs 'roles' or 'identities'", i)
+		}
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("rule %d needs 'paths'", i)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid path glob '%s'", i, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// matchPathGlob reports whether a /-separated path matches a glob, where "*" matches within one
+// path element and "**" matches any number of elements, including none
+func matchPathGlob(pattern, target string) bool {
+	return matchGlobTokens(GetStrTokens(pattern, "", "/"), GetStrTokens(target, "", "/"))
+}
+
+func matchGlobTokens(pattern, target []string) bool {
+	if len(pattern) == 0 {
+		return len(target) == 0
+	}
+
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(target); skip++ {
+			if matchGlobTokens(pattern[1:], target[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(target) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], target[0]); !matched {
+		return false
+	}
+	return matchGlobTokens(pattern[1:], target[1:])
+}
+
+// aclPaths are the request paths whose access is controlled by the ACL rather than by the built-in roles
+var aclPaths = []string{"/model", "/node", "/config", "/batch", "/history"}
+
+// AccessPolicy decides which requests the ACL allows a client to make. A nil policy allows everything.
+type AccessPolicy struct {
+	principal *Principal
+	rules     []AclRule
+}
+
+// newAccessPolicy returns the policy for the principal, or nil if there is no ACL or the principal is an admin
+func newAccessPolicy(rules []AclRule, principal *Principal) *AccessPolicy {
+	if len(rules) == 0 || principal.HasRole(RoleAdmin) {
+		return nil
+	}
+	return &AccessPolicy{principal: principal, rules: rules}
+}
+
+// Allows reports whether a request with the method may access the request path or its parents
+func (p *AccessPolicy) Allows(method, requestPath string) bool {
+	if p == nil {
+		return true
+	}
+
+	tokens := GetStrTokens(requestPath, "", "/")
+	for _, rule := range p.rules {
+		if !rule.appliesTo(p.principal) || !rule.allowsMethod(method) {
+			continue
+		}
+		for _, pattern := range rule.Paths {
+			for i := len(tokens); i > 0; i-- {
+				if matchPathGlob(pattern, strings.Join(tokens[:i], "/")) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// FilterReadable returns the data read from the model path without the children the client may not read.
+// It returns false if the client may read neither the path nor anything beneath it.
+func (p *AccessPolicy) FilterReadable(modelPath string, data any) (any, bool) {
+	if p.Allows(http.MethodGet, "/model/"+modelPath) {
+		return data, true
+	}
+
+	dataMap, ok := data.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	filtered := make(map[string]any)
+	for key, child := range dataMap {
+		childPath := key
+		if modelPath != "" {
+			childPath = modelPath + "/" + key
+		}
+		if filteredChild, readable := p.FilterReadable(childPath, child); readable {
+			filtered[key] = filteredChild
+		}
+	}
+
+	return filtered, len(filtered) > 0
+}
+
+// forbidden creates the error for a request the client may not make
+func (p *AccessPolicy) forbidden(method, requestPath string) error {
+	return newError(ErrForbidden, "'%s' may not make %s requests to %s", p.principal.Name, method, requestPath)
+}
+
+// checkWrite checks that a write with the method to the model path is allowed
+func (p *AccessPolicy) checkWrite(method, modelPath string) error {
+	if p.Allows(method, "/model/"+modelPath) {
+		return nil
+	}
+	return p.forbidden(method, "/model/"+modelPath)
+}
+
+// checkRequest checks a request to one of the ACL's paths. Reads of the model and its history and batches are
+// allowed through, since their handlers filter the data and check the operations.
+func (p *AccessPolicy) checkRequest(r *http.Request) error {
+	isModelRead := r.Method == http.MethodGet && (isSubPath(r.URL.Path, "/model") || isSubPath(r.URL.Path, "/history"))
+	if p == nil || isModelRead || r.URL.Path == "/batch" || p.Allows(r.Method, r.URL.Path) {
+		return nil
+	}
+	return p.forbidden(r.Method, r.URL.Path)
+}
+
+type accessPolicyKey struct{}
+
+// accessPolicyFromRequest returns the ACL's policy for the client of a request, or nil if it may do anything
+func accessPolicyFromRequest(r *http.Request) *AccessPolicy {
+	policy, _ := r.Context().Value(accessPolicyKey{}).(*AccessPolicy)
+	return policy
+}
+
+// withAccessPolicy adds the ACL's policy for the client to the request's context
+func withAccessPolicy(r *http.Request, policy *AccessPolicy) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), accessPolicyKey{}, policy))
+}
+
+// isAclPath reports whether the ACL controls access to a request path
+func isAclPath(requestPath string) bool {
+	for _, aclPath := range aclPaths {
+		if isSubPath(requestPath, aclPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		target  string
+		want    bool
+	}{
+		{"/model/setpoints", "/model/setpoints", true},
+		{"/model/setpoints", "/model/setpoints/speed", false},
+		{"/model/setpoints", "/model", false},
+		{"/model/*", "/model/setpoints", true},
+		{"/model/*", "/model/setpoints/speed", false},
+		{"/model/*", "/model", false},
+		{"/model/line*/speed", "/model/line3/speed", true},
+		{"/model/line*/speed", "/model/press3/speed", false},
+		{"/model/line?/speed", "/model/line3/speed", true},
+		{"/model/line?/speed", "/model/line10/speed", false},
+		{"/model/**", "/model", true},
+		{"/model/**", "/model/setpoints", true},
+		{"/model/**", "/model/setpoints/line3/speed", true},
+		{"/model/**", "/node/setpoints", false},
+		{"/model/**/speed", "/model/speed", true},
+		{"/model/**/speed", "/model/setpoints/line3/speed", true},
+		{"/model/**/speed", "/model/setpoints/line3/mode", false},
+		{"**", "/anything/at/all", true},
+		{"**", "", true},
+		{"sensors/*/temp", "sensors/line3/temp", true},
+		{"sensors/*/temp", "/sensors/line3/temp", true},
+		{"sensors/*/temp", "sensors/line3/temp/raw", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPathGlob(tt.pattern, tt.target); got != tt.want {
+			t.Errorf("matchPathGlob(%q, %q) = %v, want %v", tt.pattern, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestAccessPolicyAllows(t *testing.T) {
+	rules := []AclRule{
+		{Roles: []string{"operator"}, Methods: []string{"GET"}, Paths: []string{"/model/**"}},
+		{Roles: []string{"operator"}, Methods: []string{"POST"}, Paths: []string{"/model/setpoints/**", "/node/*"}},
+		{Identities: []string{"erp-sync"}, Paths: []string{"/model/erp"}},
+	}
+	operator := &Principal{Name: "panel", Roles: []string{"operator"}}
+	erpSync := &Principal{Name: "erp-sync"}
+	admin := &Principal{Name: "ops", Roles: []string{RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		method    string
+		path      string
+		want      bool
+	}{
+		{"role may read", operator, http.MethodGet, "/model/erp/secret", true},
+		{"role may write matching path", operator, http.MethodPost, "/model/setpoints/line3/speed", true},
+		{"role may not write other path", operator, http.MethodPost, "/model/erp/secret", false},
+		{"role may post to node", operator, http.MethodPost, "/node/line3", true},
+		{"method not in rule", operator, http.MethodDelete, "/model/setpoints/line3", false},
+		{"identity has all methods", erpSync, http.MethodDelete, "/model/erp", true},
+		{"access includes paths beneath", erpSync, http.MethodPost, "/model/erp/orders/42", true},
+		{"access doesn't include parents", erpSync, http.MethodGet, "/model", false},
+		{"identity can't use other rules", erpSync, http.MethodGet, "/model/setpoints", false},
+		{"admin may do anything", admin, http.MethodDelete, "/config", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newAccessPolicy(rules, tt.principal)
+			if got := policy.Allows(tt.method, tt.path); got != tt.want {
+				t.Errorf("Allows(%s, %q) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeHandlerChecksEveryPath(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"setpoints": {"a": 1}, "erp": {"secret": 2}},
+		"nodes": {"mixed": ["setpoints/a", "erp/secret"]}}`)
+	server := CreateServer(*dataModel)
+	policy := newAccessPolicy([]AclRule{
+		{Roles: []string{"operator"}, Methods: []string{"POST"}, Paths: []string{"/model/setpoints/**", "/node/**"}},
+	}, &Principal{Name: "panel", Roles: []string{"operator"}})
+
+	r := httptest.NewRequest(http.MethodPost, "/node/mixed", strings.NewReader("5"))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.NodeHandler(w, withAccessPolicy(r, policy))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if value, _ := LookupPath(server.dataModel.Model, []string{"setpoints", "a"}); value != 1.0 {
+		t.Errorf("setpoints/a = %v, want it unchanged", value)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the audit log configuration
+const (
+	defaultAuditMaxSizeBytes = 10 << 20
+	defaultAuditMaxFiles     = 5
+	defaultAuditQueryLimit   = 1000
+)
+
+// Kinds of sources of changes
+const (
+	SourceHTTP     = "http"     // A request to /model, /node, /batch, /config or /snapshots
+	SourceMqtt     = "mqtt"     // A message on a subscribed topic
+	SourceSchedule = "schedule" // A scheduled transformation storing its result
+	SourceScript   = "script"   // A transformation calling model.set
+	SourceTtl      = "ttl"      // A value exceeding the maximum age of its TTL rule
+	SourceConfig   = "config"   // config.json, as the source of values that are covered by TTL rules
+)
+
+// ChangeSource describes what made a change to the model or the configuration
+type ChangeSource struct {
+	Kind           string `json:"kind"`                     // One of the Source kinds
+	Identity       string `json:"identity,omitempty"`       // Name of the authenticated HTTP client
+	Address        string `json:"address,omitempty"`        // IP address of the HTTP client
+	Node           string `json:"node,omitempty"`           // Node written by the HTTP request
+	Topic          string `json:"topic,omitempty"`          // MQTT topic of the message
+	Transformation string `json:"transformation,omitempty"` // Path of the transformation
+	Quality        string `json:"quality,omitempty"`        // Quality of the value reported by the writer, good if empty
+}
+
+// httpSource describes the client of an HTTP request as the source of its changes
+func httpSource(r *http.Request) ChangeSource {
+	source := ChangeSource{Kind: SourceHTTP, Address: r.RemoteAddr}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		source.Address = host
+	}
+	if principal := principalFromRequest(r); principal != nil {
+		source.Identity = principal.Name
+	}
+	return source
+}
+
+// AuditConfig configures the audit log, a JSON Lines file recording every change to the model and configuration
+type AuditConfig struct {
+	File         string `json:"file"`                   // Path of the log file
+	MaxSizeBytes int64  `json:"maxSizeBytes,omitempty"` // Size at which the file is rotated, 10MB by default
+	MaxFiles     int    `json:"maxFiles,omitempty"`     // Number of rotated files kept, 5 by default
+}
+
+// AuditEntry records one change
+type AuditEntry struct {
+	Time     time.Time    `json:"time"`
+	Action   string       `json:"action"`             // "set", "delete", "stale" or "config"
+	Path     string       `json:"path,omitempty"`     // Model path that was set or deleted, or the transformation or node configured
+	OldValue any          `json:"oldValue,omitempty"` // Value before the change, if there was one
+	NewValue any          `json:"newValue,omitempty"` // Value after the change, if there is one
+	Sections []string     `json:"sections,omitempty"` // Sections of the configuration that changed
+	Source   ChangeSource `json:"source"`
+}
+
+// auditLog writes audit entries to a rotating file. It is shared by the copies of a data model.
+type auditLog struct {
+	mu     sync.Mutex
+	config *AuditConfig // nil while the audit log is disabled
+	file   *os.File
+	size   int64
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{}
+}
+
+// validateAuditConfig checks the configuration, and that the log file can be written
+func validateAuditConfig(config *AuditConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.File == "" {
+		return newError(ErrBadRequest, "invalid audit config: 'file' is required")
+	}
+	if config.MaxSizeBytes < 0 || config.MaxFiles < 0 {
+		return newError(ErrBadRequest, "invalid audit config: 'maxSizeBytes' and 'maxFiles' can't be negative")
+	}
+
+	file, err := os.OpenFile(config.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return newError(ErrBadRequest, "invalid audit config: %w", err)
+	}
+	return file.Close()
+}
+
+// configure switches to the configuration, closing the previous file. A nil configuration disables the log.
+func (a *auditLog) configure(config *AuditConfig) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file != nil {
+		a.file.Close()
+		a.file, a.config = nil, nil
+	}
+	if config == nil {
+		return nil
+	}
+
+	resolved := *config
+	if resolved.MaxSizeBytes == 0 {
+		resolved.MaxSizeBytes = defaultAuditMaxSizeBytes
+	}
+	if resolved.MaxFiles == 0 {
+		resolved.MaxFiles = defaultAuditMaxFiles
+	}
+
+	if err := a.open(resolved.File); err != nil {
+		return err
+	}
+	a.config = &resolved
+	return nil
+}
+
+// open opens the log file for appending. The caller must hold the lock.
+func (a *auditLog) open(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// record appends an entry to the log. Failures are logged rather than failing the change.
+func (a *auditLog) record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.config == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry for '%s': %v", entry.Path, err)
+		return
+	}
+	line = append(line, '\n')
+
+	if a.size > 0 && a.size+int64(len(line)) > a.config.MaxSizeBytes {
+		if err := a.rotate(); err != nil {
+			log.Printf("Error rotating audit log: %v", err)
+		}
+	}
+	if a.file == nil {
+		return
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// rotate renames the file to file.1, shifting older files up to file.<maxFiles> and dropping the oldest.
+// The caller must hold the lock.
+func (a *auditLog) rotate() error {
+	a.file.Close()
+	a.file = nil
+
+	path := a.config.File
+	os.Remove(rotatedAuditFile(path, a.config.MaxFiles))
+	for i := a.config.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(rotatedAuditFile(path, i), rotatedAuditFile(path, i+1))
+	}
+	if err := os.Rename(path, rotatedAuditFile(path, 1)); err != nil {
+		return err
+	}
+
+	return a.open(path)
+}
+
+func rotatedAuditFile(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+// AuditQuery selects audit entries
+type AuditQuery struct {
+	Path   string    // Only entries for changes at, above or beneath the path, if set
+	Since  time.Time // Only entries at or after the time
+	Before time.Time // Only entries before the time, if set
+	Limit  int       // Maximum number of entries, the most recent ones
+}
+
+// matches reports whether the query selects the entry. Configuration changes may change any path.
+func (q AuditQuery) matches(entry AuditEntry) bool {
+	if entry.Time.Before(q.Since) || (!q.Before.IsZero() && !entry.Time.Before(q.Before)) {
+		return false
+	}
+	if q.Path == "" || entry.Action == "config" {
+		return true
+	}
+	return isSubPath(entry.Path, q.Path) || isSubPath(q.Path, entry.Path)
+}
+
+// query returns the most recent selected entries from the current and rotated files, oldest first.
+// Files are read newest first, so that the recent entries are found without reading older files. Only the audit
+// log's lock is held while reading them, so queries delay new entries but not reads of the model.
+func (a *auditLog) query(q AuditQuery) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.config == nil {
+		return nil, newError(ErrNotFound, "the audit log is disabled")
+	}
+
+	files := []string{a.config.File}
+	for i := 1; i <= a.config.MaxFiles; i++ {
+		files = append(files, rotatedAuditFile(a.config.File, i))
+	}
+
+	var newestFirst []AuditEntry
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading audit log: %w", err)
+		}
+
+		var fileEntries []AuditEntry
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(nil, len(content)+1)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue // A line cut short by a crash
+			}
+			fileEntries = append(fileEntries, entry)
+		}
+
+		for i := len(fileEntries) - 1; i >= 0; i-- {
+			if q.matches(fileEntries[i]) {
+				newestFirst = append(newestFirst, fileEntries[i])
+				if len(newestFirst) == q.Limit {
+					return reversedAuditEntries(newestFirst), nil
+				}
+			}
+		}
+
+		// Older files only have entries before this one's
+		if len(fileEntries) > 0 && fileEntries[0].Time.Before(q.Since) {
+			break
+		}
+	}
+
+	return reversedAuditEntries(newestFirst), nil
+}
+
+// reversedAuditEntries returns the entries in reverse order
+func reversedAuditEntries(entries []AuditEntry) []AuditEntry {
+	reversed := make([]AuditEntry, len(entries))
+	for i, entry := range entries {
+		reversed[len(entries)-1-i] = entry
+	}
+	return reversed
+}
+
+// configSections returns the top-level sections of the configuration that differ between the data models
+func configSections(oldModel, newModel *DataModel) []string {
+	var oldSections, newSections map[string]json.RawMessage
+	oldJson, _ := json.Marshal(oldModel)
+	newJson, _ := json.Marshal(newModel)
+	json.Unmarshal(oldJson, &oldSections)
+	json.Unmarshal(newJson, &newSections)
+
+	changed := []string{}
+	for section, value := range newSections {
+		if !bytes.Equal(value, oldSections[section]) {
+			changed = append(changed, section)
+		}
+	}
+	for section := range oldSections {
+		if _, ok := newSections[section]; !ok {
+			changed = append(changed, section)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// AuditHandler handles queries of the audit log
+func (s *Server) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	// The data model's lock is only needed to find the audit log, which has its own lock for reading the files
+	s.mu.Lock()
+	audit := s.dataModel.audit
+	s.mu.Unlock()
+
+	entries, err := audit.query(query)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, entries, http.StatusOK)
+}
+
+// parseTimeParam parses a query parameter that is an RFC 3339 time, or a duration before now like "24h"
+func parseTimeParam(name, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, newError(ErrBadRequest, "invalid '%s' '%s', expected an RFC 3339 time or a duration", name, value)
+}
+
+// parseAuditQuery reads the path, since, before and limit query parameters. since and before are RFC 3339 times
+// or durations before now, like "24h".
+func parseAuditQuery(r *http.Request) (AuditQuery, error) {
+	params := r.URL.Query()
+	query := AuditQuery{Path: strings.Trim(params.Get("path"), "/"), Limit: defaultAuditQueryLimit}
+
+	if since := params.Get("since"); since != "" {
+		var err error
+		if query.Since, err = parseTimeParam("since", since); err != nil {
+			return query, err
+		}
+	}
+
+	if before := params.Get("before"); before != "" {
+		var err error
+		if query.Before, err = parseTimeParam("before", before); err != nil {
+			return query, err
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return query, newError(ErrBadRequest, "invalid 'limit' '%s', expected a positive number", limit)
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditQuery(t *testing.T) {
+	audit := newAuditLog()
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := audit.configure(&AuditConfig{File: file, MaxSizeBytes: 300, MaxFiles: 10}); err != nil {
+		t.Fatalf("configure error = %v", err)
+	}
+	t.Cleanup(func() { audit.configure(nil) })
+
+	// Entries 0 to 9, one a minute, alternating between two paths and rotated every few entries
+	start := time.Date(2026, 3, 14, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		path := "sensors/a"
+		if i%2 == 1 {
+			path = "sensors/b"
+		}
+		audit.record(AuditEntry{Time: start.Add(time.Duration(i) * time.Minute), Action: "set", Path: path,
+			NewValue: float64(i), Source: ChangeSource{Kind: SourceHTTP}})
+	}
+	if _, err := os.Stat(rotatedAuditFile(file, 2)); err != nil {
+		t.Fatalf("audit log wasn't rotated: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query AuditQuery
+		want  []float64
+	}{
+		{"all", AuditQuery{}, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"limit keeps the most recent", AuditQuery{Limit: 3}, []float64{7, 8, 9}},
+		{"path", AuditQuery{Path: "sensors/a", Limit: 2}, []float64{6, 8}},
+		{"parent path", AuditQuery{Path: "sensors", Limit: 2}, []float64{8, 9}},
+		{"since", AuditQuery{Since: start.Add(8 * time.Minute)}, []float64{8, 9}},
+		{"before pages back", AuditQuery{Before: start.Add(5 * time.Minute), Limit: 2}, []float64{3, 4}},
+		{"since and before", AuditQuery{Since: start.Add(2 * time.Minute), Before: start.Add(4 * time.Minute)}, []float64{2, 3}},
+		{"no matches", AuditQuery{Path: "setpoints"}, []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := audit.query(tt.query)
+			if err != nil {
+				t.Fatalf("query error = %v", err)
+			}
+			got := []float64{}
+			for _, entry := range entries {
+				got = append(got, entry.NewValue.(float64))
+			}
+			gotJson, _ := json.Marshal(got)
+			wantJson, _ := json.Marshal(tt.want)
+			if string(gotJson) != string(wantJson) {
+				t.Errorf("query(%+v) = %s, want %s", tt.query, gotJson, wantJson)
+			}
+		})
+	}
+}
+
+func TestAuditQueryDisabled(t *testing.T) {
+	if _, err := newAuditLog().query(AuditQuery{}); err == nil {
+		t.Error("query of a disabled audit log succeeded, want an error")
+	}
+}
+
+func TestTransformationAndNodeChangesAudited(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"a": 1}, "nodes": {"n": ["a"]}}`)
+	server := CreateServer(*dataModel)
+	if err := server.dataModel.audit.configure(&AuditConfig{File: filepath.Join(t.TempDir(), "audit.jsonl")}); err != nil {
+		t.Fatalf("configure error = %v", err)
+	}
+	t.Cleanup(func() { server.dataModel.audit.configure(nil) })
+
+	requests := []struct {
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{server.TransformationsHandler, http.MethodPut, "/transformations/a", `{"implementation": "self * 2"}`},
+		{server.TransformationsHandler, http.MethodDelete, "/transformations/a", ``},
+		{server.NodesHandler, http.MethodPut, "/nodes/n", `["a", "b"]`},
+		{server.NodesHandler, http.MethodPut, "/nodes/m", `["a"]`},
+		{server.NodesHandler, http.MethodDelete, "/nodes/m", ``},
+	}
+	for _, request := range requests {
+		r := httptest.NewRequest(request.method, request.target, strings.NewReader(request.body))
+		r.Header.Set("Content-Type", "application/json")
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		request.handler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d: %s", request.method, request.target, w.Code, w.Body)
+		}
+	}
+
+	entries, err := server.dataModel.audit.query(AuditQuery{})
+	if err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	want := []string{
+		`{"action":"config","path":"a","newValue":{"implementation":"self * 2"},"sections":["transformations"]}`,
+		`{"action":"config","path":"a","oldValue":{"implementation":"self * 2"},"sections":["transformations"]}`,
+		`{"action":"config","path":"n","oldValue":["a"],"newValue":["a","b"],"sections":["nodes"]}`,
+		`{"action":"config","path":"m","newValue":["a"],"sections":["nodes"]}`,
+		`{"action":"config","path":"m","oldValue":["a"],"sections":["nodes"]}`,
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Source.Kind != SourceHTTP || entry.Source.Address != "192.0.2.1" {
+			t.Errorf("entry %d source = %+v, want the HTTP client", i, entry.Source)
+		}
+		got, _ := json.Marshal(struct {
+			Action   string   `json:"action"`
+			Path     string   `json:"path"`
+			OldValue any      `json:"oldValue,omitempty"`
+			NewValue any      `json:"newValue,omitempty"`
+			Sections []string `json:"sections"`
+		}{entry.Action, entry.Path, entry.OldValue, entry.NewValue, entry.Sections})
+		if string(got) != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"line": {"speed": 0}}}`)
+	server := CreateServer(*dataModel)
+
+	get := func(target string) (int, []AuditEntry) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.AuditHandler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var entries []AuditEntry
+		json.Unmarshal(w.Body.Bytes(), &entries)
+		return w.Code, entries
+	}
+
+	if status, _ := get("/audit"); status != http.StatusNotFound {
+		t.Errorf("GET /audit of a disabled audit log status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	if err := server.dataModel.audit.configure(&AuditConfig{File: filepath.Join(t.TempDir(), "audit.jsonl")}); err != nil {
+		t.Fatalf("configure error = %v", err)
+	}
+	t.Cleanup(func() { server.dataModel.audit.configure(nil) })
+
+	// Writes under the data model's lock go on while the log is queried
+	const writes = 50
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= writes; i++ {
+			server.mu.Lock()
+			server.dataModel.SetModelData([]string{"line", "speed"}, float64(i), ChangeSource{Kind: SourceHTTP})
+			server.mu.Unlock()
+		}
+	}()
+	for i := 0; i < writes; i++ {
+		if status, _ := get("/audit?path=line/speed"); status != http.StatusOK {
+			t.Fatalf("GET /audit status = %d, want %d", status, http.StatusOK)
+		}
+	}
+	<-done
+
+	status, entries := get("/audit?path=line&limit=2")
+	if status != http.StatusOK || len(entries) != 2 {
+		t.Fatalf("GET /audit?path=line&limit=2 = %d with %d entries, want 2 entries", status, len(entries))
+	}
+	if entries[0].NewValue != float64(writes-1) || entries[1].NewValue != float64(writes) {
+		t.Errorf("GET /audit?path=line&limit=2 values = %v and %v, want the last two writes", entries[0].NewValue, entries[1].NewValue)
+	}
+
+	for _, target := range []string{"/audit?limit=0", "/audit?since=yesterday"} {
+		if status, _ := get(target); status != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want %d", target, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Built-in roles granted to API keys and JWTs. Each role includes the ones before it.
+// Other roles only grant access through the ACL.
+const (
+	RoleRead  = "read"  // Read the model
+	RoleWrite = "write" // Write the model and nodes
+	RoleAdmin = "admin" // Manage the configuration, transformations and nodes
+)
+
+// roleLevels orders the roles, so that a role grants access to everything the roles below it can do
+var roleLevels = map[string]int{RoleRead: 1, RoleWrite: 2, RoleAdmin: 3}
+
+// AuthConfig configures authentication of HTTP requests.
+// Requests are only authenticated if there are API keys, client certificates or a JWT configuration.
+type AuthConfig struct {
+	ApiKeys     []ApiKey     `json:"apiKeys,omitempty"`     // Static keys, sent in the X-API-Key header or as a bearer token
+	ClientCerts []ClientCert `json:"clientCerts,omitempty"` // Identities of TLS client certificates
+	Jwt         *JwtConfig   `json:"jwt,omitempty"`         // Validation of JWT bearer tokens
+	Acl         []AclRule    `json:"acl,omitempty"`         // Access to the model, nodes and config by role or identity
+}
+
+// ApiKey is a static credential with the roles it grants
+type ApiKey struct {
+	Name  string   `json:"name"`  // Identifies the client in logs
+	Key   string   `json:"key"`   // Secret sent by the client
+	Roles []string `json:"roles"` // Roles granted to the client
+}
+
+// ClientCert identifies clients by the subject of the certificate they present over mutual TLS
+type ClientCert struct {
+	Subject string   `json:"subject"`        // Common name, or full distinguished name like "CN=plc-1,O=Plant"
+	Name    string   `json:"name,omitempty"` // Identity of the client, the subject by default
+	Roles   []string `json:"roles"`          // Roles granted to the client
+}
+
+// JwtConfig configures how JWT bearer tokens are validated. Tokens must be signed with the HMAC secret or
+// one of the keys in the JWKS file, and must have an expiry time.
+type JwtConfig struct {
+	HmacSecret string `json:"hmacSecret,omitempty"` // Secret for HS256/HS384/HS512 tokens
+	JwksFile   string `json:"jwksFile,omitempty"`   // Path of a JSON Web Key Set with the public keys of signed tokens
+	Issuer     string `json:"issuer,omitempty"`     // Required "iss" claim, if not empty
+	Audience   string `json:"audience,omitempty"`   // Required "aud" claim, if not empty
+	RolesClaim string `json:"rolesClaim,omitempty"` // Claim listing the token's roles, "roles" by default
+}
+
+// Principal is the authenticated client of a request
+type Principal struct {
+	Name    string   // Name of the API key, or subject of the JWT
+	Roles   []string // Roles granted by the credentials
+	Unnamed bool     // Whether the name is a placeholder shared by other clients, as for JWTs without a subject
+}
+
+// HasRole reports whether the principal's roles include the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, granted := range p.Roles {
+		if roleLevels[granted] >= roleLevels[role] {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// principalFromRequest returns the authenticated client of a request, or nil if authentication is disabled
+func principalFromRequest(r *http.Request) *Principal {
+	principal, _ := r.Context().Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Authenticator checks the credentials of HTTP requests
+type Authenticator struct {
+	apiKeys     []ApiKey
+	clientCerts []ClientCert
+	jwt         *JwtConfig
+	acl         []AclRule
+	hmacSecret  []byte
+	jwks        map[string]any // key: key ID, value: public key
+}
+
+// NewAuthenticator prepares the authentication configured in the data model and the environment.
+// API_KEYS adds keys as comma-separated name:key:roles entries, with roles separated by '|'.
+// JWT_HMAC_SECRET and JWT_JWKS_FILE set the corresponding JWT fields if they are empty in the config.
+func NewAuthenticator(config *AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{}
+	if config != nil {
+		a.apiKeys = append(a.apiKeys, config.ApiKeys...)
+		a.clientCerts = config.ClientCerts
+		a.acl = config.Acl
+		if config.Jwt != nil {
+			jwtConfig := *config.Jwt
+			a.jwt = &jwtConfig
+		}
+	}
+
+	if envKeys := os.Getenv("API_KEYS"); envKeys != "" {
+		for _, entry := range strings.Split(envKeys, ",") {
+			fields := strings.Split(strings.TrimSpace(entry), ":")
+			if len(fields) != 3 {
+				return nil, newError(ErrBadRequest, "invalid auth config: API_KEYS entries must have the form name:key:roles")
+			}
+			a.apiKeys = append(a.apiKeys, ApiKey{Name: fields[0], Key: fields[1], Roles: strings.Split(fields[2], "|")})
+		}
+	}
+
+	hmacSecret, jwksFile := os.Getenv("JWT_HMAC_SECRET"), os.Getenv("JWT_JWKS_FILE")
+	if a.jwt == nil && (hmacSecret != "" || jwksFile != "") {
+		a.jwt = &JwtConfig{}
+	}
+
+	for _, apiKey := range a.apiKeys {
+		if apiKey.Key == "" {
+			return nil, newError(ErrBadRequest, "invalid auth config: API key '%s' is empty", apiKey.Name)
+		}
+		if err := validateRoles(apiKey.Roles); err != nil {
+			return nil, newError(ErrBadRequest, "invalid auth config: API key '%s': %w", apiKey.Name, err)
+		}
+	}
+
+	for _, clientCert := range a.clientCerts {
+		if clientCert.Subject == "" {
+			return nil, newError(ErrBadRequest, "invalid auth config: client certificates need a 'subject'")
+		}
+		if err := validateRoles(clientCert.Roles); err != nil {
+			return nil, newError(ErrBadRequest, "invalid auth config: client certificate '%s': %w", clientCert.Subject, err)
+		}
+	}
+
+	if a.jwt != nil {
+		if a.jwt.HmacSecret == "" {
+			a.jwt.HmacSecret = hmacSecret
+		}
+		if a.jwt.JwksFile == "" {
+			a.jwt.JwksFile = jwksFile
+		}
+		if a.jwt.RolesClaim == "" {
+			a.jwt.RolesClaim = "roles"
+		}
+		if a.jwt.HmacSecret == "" && a.jwt.JwksFile == "" {
+			return nil, newError(ErrBadRequest, "invalid auth config: 'jwt' needs an 'hmacSecret' or a 'jwksFile'")
+		}
+
+		if a.jwt.HmacSecret != "" {
+			a.hmacSecret = []byte(a.jwt.HmacSecret)
+		}
+		if a.jwt.JwksFile != "" {
+			jwks, err := loadJwks(a.jwt.JwksFile)
+			if err != nil {
+				return nil, newError(ErrBadRequest, "invalid auth config: %w", err)
+			}
+			a.jwks = jwks
+		}
+	}
+
+	if len(a.acl) > 0 {
+		if !a.Enabled() {
+			return nil, newError(ErrBadRequest, "invalid auth config: 'acl' needs 'apiKeys', 'clientCerts' or 'jwt' to identify clients")
+		}
+		if err := validateAcl(a.acl); err != nil {
+			return nil, newError(ErrBadRequest, "invalid auth config: 'acl': %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// validateRoles checks that the role names are usable
+func validateRoles(roles []string) error {
+	for _, role := range roles {
+		if role == "" || strings.ContainsAny(role, " \t") {
+			return fmt.Errorf("invalid role '%s'", role)
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether requests need credentials
+func (a *Authenticator) Enabled() bool {
+	return len(a.apiKeys) > 0 || len(a.clientCerts) > 0 || a.jwt != nil
+}
+
+// Authenticate identifies the client of a request from its X-API-Key header or bearer token,
+// or without those, from its verified TLS client certificate
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	credential := r.Header.Get("X-API-Key")
+	if credential == "" {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return a.matchClientCert(r.TLS.VerifiedChains[0][0])
+		}
+
+		scheme, token, found := strings.Cut(authorization, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return nil, newError(ErrUnauthorized, "missing credentials: send an X-API-Key header or a bearer token")
+		}
+		credential = strings.TrimSpace(token)
+	}
+
+	if principal := a.matchApiKey(credential); principal != nil {
+		return principal, nil
+	}
+
+	if a.jwt != nil && strings.Count(credential, ".") == 2 {
+		principal, err := a.validateJwt(credential)
+		if err != nil {
+			return nil, newError(ErrUnauthorized, "invalid token: %s", err.Error())
+		}
+		return principal, nil
+	}
+
+	return nil, newError(ErrUnauthorized, "invalid credentials")
+}
+
+// matchApiKey returns the principal of the API key equal to the credential, or nil if there is none
+func (a *Authenticator) matchApiKey(credential string) *Principal {
+	var match *Principal
+	for _, apiKey := range a.apiKeys {
+		// Compare every key in constant time, so that timing doesn't reveal anything about the keys
+		if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(credential)) == 1 {
+			match = &Principal{Name: apiKey.Name, Roles: apiKey.Roles}
+		}
+	}
+	return match
+}
+
+// matchClientCert returns the principal of a verified client certificate
+func (a *Authenticator) matchClientCert(certificate *x509.Certificate) (*Principal, error) {
+	for _, clientCert := range a.clientCerts {
+		if clientCert.Subject == certificate.Subject.CommonName || clientCert.Subject == certificate.Subject.String() {
+			principal := &Principal{Name: clientCert.Name, Roles: clientCert.Roles}
+			if principal.Name == "" {
+				principal.Name = clientCert.Subject
+			}
+			return principal, nil
+		}
+	}
+
+	return nil, newError(ErrUnauthorized, "client certificate '%s' doesn't match any of the configured identities",
+		certificate.Subject.String())
+}
+
+// validateJwt checks the signature and claims of a JWT, returning its subject and roles
+func (a *Authenticator) validateJwt(tokenString string) (*Principal, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512",
+			"PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.jwt.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.jwt.Issuer))
+	}
+	if a.jwt.Audience != "" {
+		options = append(options, jwt.WithAudience(a.jwt.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, a.signingKey, options...); err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Name: "jwt", Unnamed: true}
+	if subject, err := claims.GetSubject(); err == nil && subject != "" {
+		principal.Name, principal.Unnamed = subject, false
+	}
+
+	// Roles may be listed in an array, or in a space-separated string like OAuth scopes
+	switch roles := claims[a.jwt.RolesClaim].(type) {
+	case []any:
+		for _, role := range roles {
+			if roleString, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, roleString)
+			}
+		}
+	case string:
+		principal.Roles = strings.Fields(roles)
+	}
+
+	return principal, nil
+}
+
+// signingKey returns the key that should have signed a token: the HMAC secret for HMAC tokens if there is
+// one, otherwise the key in the JWKS with the token's key ID. The JWT library checks that the key's type
+// matches the token's algorithm.
+func (a *Authenticator) signingKey(token *jwt.Token) (any, error) {
+	if _, isHmac := token.Method.(*jwt.SigningMethodHMAC); isHmac && a.hmacSecret != nil {
+		return a.hmacSecret, nil
+	}
+
+	keyID, _ := token.Header["kid"].(string)
+	if key, exists := a.jwks[keyID]; exists {
+		return key, nil
+	}
+	if keyID == "" && len(a.jwks) == 1 {
+		for _, key := range a.jwks {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no key with ID '%s'", keyID)
+}
+
+// modelRole is the role needed for requests that read or write the model: read for GET, and write otherwise
+func modelRole(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return RoleRead
+	}
+	return RoleWrite
+}
+
+// batchRole is the role needed for batches, whose write operations are checked against the write role separately
+func batchRole(r *http.Request) string {
+	return RoleRead
+}
+
+// adminRole is the role needed for requests that manage the server's configuration
+func adminRole(r *http.Request) string {
+	return RoleAdmin
+}
+
+// authenticated wraps a handler so that it only serves requests with credentials granting the role the request
+// needs, or that the ACL allows if it controls the request's path. It responds with 401 Unauthorized to requests
+// without valid credentials, 403 Forbidden to requests that aren't allowed, and 429 Too Many Requests to clients
+// exceeding the rate limit. While authentication is disabled, only the rate limit applies.
+func (s *Server) authenticated(requiredRole func(*http.Request) string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authenticator := s.auth.Load()
+		if !authenticator.Enabled() {
+			if err := s.rateLimited(r, nil); err != nil {
+				sendErrorResponse(w, r, err)
+				return
+			}
+			handler(w, r)
+			return
+		}
+
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			// Failed attempts count against the client's IP address, slowing down guessing
+			if err := s.rateLimited(r, nil); err != nil {
+				sendErrorResponse(w, r, err)
+				return
+			}
+			log.Printf("Rejected %s request to %s: %v", r.Method, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="json-gator"`)
+			sendErrorResponse(w, r, err)
+			return
+		}
+		if err := s.rateLimited(r, principal); err != nil {
+			log.Printf("Rejected %s request to %s from '%s': rate limit exceeded", r.Method, r.URL.Path, principal.Name)
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		if len(authenticator.acl) > 0 && isAclPath(r.URL.Path) {
+			policy := newAccessPolicy(authenticator.acl, principal)
+			if err := policy.checkRequest(r); err != nil {
+				log.Printf("Rejected %s request to %s from '%s': not allowed by the ACL", r.Method, r.URL.Path, principal.Name)
+				sendErrorResponse(w, r, err)
+				return
+			}
+			r = withAccessPolicy(r, policy)
+		} else if role := requiredRole(r); !principal.HasRole(role) {
+			log.Printf("Rejected %s request to %s from '%s': missing role '%s'", r.Method, r.URL.Path, principal.Name, role)
+			sendErrorResponse(w, r, newError(ErrForbidden, "'%s' needs the '%s' role for %s requests to %s",
+				principal.Name, role, r.Method, r.URL.Path))
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// configureAuth replaces the server's authentication with the configuration
+func (s *Server) configureAuth(config *AuthConfig) error {
+	authenticator, err := NewAuthenticator(config)
+	if err != nil {
+		return err
+	}
+
+	if !authenticator.Enabled() {
+		log.Println("WARNING: authentication is disabled, anyone who can reach the server can change its configuration")
+	}
+	s.auth.Store(authenticator)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testHmacSecret = "test-secret"
+
+// signTestJwt signs the claims with the secret, adding an expiry time in an hour unless the claims have one.
+// Tokens using the "none" method aren't signed.
+func signTestJwt(t *testing.T, method jwt.SigningMethod, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	var key any = []byte(secret)
+	if method == jwt.SigningMethodNone {
+		key = jwt.UnsafeAllowNoneSignatureType
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("error signing test token: %v", err)
+	}
+	return token
+}
+
+func TestAuthenticateJwt(t *testing.T) {
+	t.Setenv("API_KEYS", "")
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_JWKS_FILE", "")
+
+	authenticator, err := NewAuthenticator(&AuthConfig{
+		ApiKeys: []ApiKey{{Name: "dashboard", Key: "key-1", Roles: []string{RoleRead}}},
+		Jwt:     &JwtConfig{HmacSecret: testHmacSecret, Issuer: "plant", Audience: "datagator"},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator error = %v", err)
+	}
+
+	valid := jwt.MapClaims{"iss": "plant", "aud": "datagator", "sub": "line-1"}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		wantName  string
+		wantRoles string
+	}{
+		{"roles array", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			with("roles", []string{RoleWrite, "operators"})), "line-1", "write,operators"},
+		{"roles string", "Authorization", "bearer " + signTestJwt(t, jwt.SigningMethodHS512, testHmacSecret,
+			with("roles", "read admin")), "line-1", "read,admin"},
+		{"no roles", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret, with("x", 1)),
+			"line-1", ""},
+		{"api key header", "X-API-Key", "key-1", "dashboard", "read"},
+		{"no subject", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			jwt.MapClaims{"iss": "plant", "aud": "datagator", "roles": "read"}), "jwt", "read"},
+		{"api key bearer", "Authorization", "Bearer key-1", "dashboard", "read"},
+		{"wrong secret", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, "other", with("x", 1)), "", ""},
+		{"expired", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			with("exp", time.Now().Add(-time.Minute).Unix())), "", ""},
+		{"no expiry", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			with("exp", nil)), "", ""},
+		{"wrong issuer", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			with("iss", "other")), "", ""},
+		{"wrong audience", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodHS256, testHmacSecret,
+			with("aud", "other")), "", ""},
+		{"unsigned", "Authorization", "Bearer " + signTestJwt(t, jwt.SigningMethodNone, "", with("x", 1)), "", ""},
+		{"unknown api key", "X-API-Key", "key-2", "", ""},
+		{"basic auth", "Authorization", "Basic a2V5LTE=", "", ""},
+		{"no credentials", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/model", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			principal, err := authenticator.Authenticate(r)
+			if tt.wantName == "" {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Fatalf("Authenticate() = %+v, %v, want unauthorized", principal, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.Name != tt.wantName || strings.Join(principal.Roles, ",") != tt.wantRoles || principal.Unnamed != (tt.wantName == "jwt") {
+				t.Errorf("Authenticate() = %+v, want %s with roles %q", principal, tt.wantName, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorRejectsInvalidConfig(t *testing.T) {
+	t.Setenv("API_KEYS", "")
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_JWKS_FILE", "")
+
+	tests := []struct {
+		name   string
+		config *AuthConfig
+	}{
+		{"empty api key", &AuthConfig{ApiKeys: []ApiKey{{Name: "a", Roles: []string{RoleRead}}}}},
+		{"invalid role", &AuthConfig{ApiKeys: []ApiKey{{Name: "a", Key: "k", Roles: []string{"read write"}}}}},
+		{"jwt without keys", &AuthConfig{Jwt: &JwtConfig{Issuer: "plant"}}},
+		{"acl without credentials", &AuthConfig{Acl: []AclRule{{Roles: []string{RoleRead}, Paths: []string{"**"}}}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewAuthenticator(tt.config); !errors.Is(err, ErrBadRequest) {
+			t.Errorf("%s: NewAuthenticator() error = %v, want bad_request", tt.name, err)
+		}
+	}
+}
+
+func TestNewAuthenticatorAclCredentials(t *testing.T) {
+	t.Setenv("API_KEYS", "")
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_JWKS_FILE", "")
+
+	acl := []AclRule{{Roles: []string{RoleRead}, Paths: []string{"/model/**"}}}
+
+	_, err := NewAuthenticator(&AuthConfig{Acl: acl})
+	if err == nil {
+		t.Fatal("NewAuthenticator() with an ACL and no credentials succeeded, want an error")
+	}
+	for _, field := range []string{"apiKeys", "clientCerts", "jwt"} {
+		if !strings.Contains(err.Error(), "'"+field+"'") {
+			t.Errorf("NewAuthenticator() error = %q, want it to name '%s'", err, field)
+		}
+	}
+
+	// Client certificates alone identify clients well enough for an ACL
+	clientCerts := []ClientCert{{Subject: "plc-1", Roles: []string{RoleRead}}}
+	if _, err := NewAuthenticator(&AuthConfig{ClientCerts: clientCerts, Acl: acl}); err != nil {
+		t.Errorf("NewAuthenticator() with client certificates and an ACL error = %v", err)
+	}
+}
+
+func TestPrincipalHasRole(t *testing.T) {
+	tests := []struct {
+		roles []string
+		role  string
+		want  bool
+	}{
+		{[]string{RoleRead}, RoleRead, true},
+		{[]string{RoleRead}, RoleWrite, false},
+		{[]string{RoleWrite}, RoleRead, true},
+		{[]string{RoleAdmin}, RoleWrite, true},
+		{[]string{"operators"}, RoleRead, false},
+		{[]string{"operators", RoleWrite}, RoleAdmin, false},
+		{nil, RoleRead, false},
+	}
+
+	for _, tt := range tests {
+		principal := &Principal{Name: "client", Roles: tt.roles}
+		if got := principal.HasRole(tt.role); got != tt.want {
+			t.Errorf("HasRole(%q) with roles %v = %v, want %v", tt.role, tt.roles, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BatchOperation is one read or write in a batch
+type BatchOperation struct {
+	Op    string `json:"op"`    // "get", "set" or "delete"
+	Path  string `json:"path"`  // /-separated path in the model
+	Value any    `json:"value"` // Value written by "set"
+}
+
+// BatchResult is the outcome of one operation in a batch
+type BatchResult struct {
+	Status  int    `json:"status"`            // HTTP status code the operation would have had on its own
+	Code    string `json:"code,omitempty"`    // Machine-readable kind of the error, as in error responses
+	Value   any    `json:"value,omitempty"`   // Value read by "get"
+	Version uint64 `json:"version,omitempty"` // Version of the path after the operation
+	Error   string `json:"error,omitempty"`   // Why the operation failed
+}
+
+// ApplyBatch performs the operations in order, continuing after failed operations, then publishes each MQTT
+// mapping affected by the writes once. Writes fail if canWrite is false, and operations the access policy doesn't
+// allow and writes the throttle rejects fail too, while reads leave out what the policy doesn't allow reading.
+// Writes are audited as made by the source. The caller must hold the lock, making the batch a single critical section.
+func (d *DataModel) ApplyBatch(operations []BatchOperation, policy *AccessPolicy, canWrite bool, throttle *writeThrottle, source ChangeSource) ([]BatchResult, error) {
+	results := make([]BatchResult, len(operations))
+	affectedMappings := make(map[string]bool)
+
+	for i, operation := range operations {
+		path := strings.Trim(operation.Path, "/")
+		pathTokens := GetStrTokens(path, "", "/")
+
+		var value any
+		var err error
+		switch operation.Op {
+		case "get":
+			value, err = d.GetModelData(pathTokens, false)
+			if err == nil {
+				// Later operations in the batch mustn't change what was read
+				value = DeepCopyValue(value)
+
+				var readable bool
+				if value, readable = policy.FilterReadable(path, value); !readable {
+					err = policy.forbidden(http.MethodGet, "/model/"+path)
+				}
+			}
+		case "set":
+			if !canWrite {
+				err = newError(ErrForbidden, "'set' operations need the '%s' role", RoleWrite)
+			} else if err = policy.checkWrite(http.MethodPost, path); err == nil {
+				err = throttle.checkWrite(path)
+			}
+			if err == nil {
+				err = d.storeModelData(pathTokens, operation.Value, source)
+			}
+			if err == nil {
+				throttle.recordWrite(path)
+			}
+		case "delete":
+			if !canWrite {
+				err = newError(ErrForbidden, "'delete' operations need the '%s' role", RoleWrite)
+			} else if err = policy.checkWrite(http.MethodDelete, path); err == nil {
+				err = throttle.checkWrite(path)
+			}
+			if err == nil {
+				err = d.deleteModelData(pathTokens, source)
+			}
+			if err == nil {
+				throttle.recordWrite(path)
+			}
+		default:
+			err = newError(ErrBadRequest, "invalid batch operation: unknown op '%s'", operation.Op)
+		}
+
+		if err != nil {
+			kind := errorKindOf(err)
+			results[i] = BatchResult{Status: kind.Status, Code: kind.Code, Error: err.Error()}
+			continue
+		}
+		results[i] = BatchResult{Status: http.StatusOK, Value: value, Version: d.PathVersion(path).Version}
+
+		if operation.Op != "get" && d.Mqtt != nil {
+			for _, mapping := range d.Mqtt.AffectedMappings(path) {
+				affectedMappings[mapping] = true
+			}
+		}
+	}
+
+	if len(affectedMappings) == 0 {
+		return results, nil
+	}
+
+	// Mappings that no longer exist after deletions have nothing to publish
+	var mappings []string
+	for mapping := range affectedMappings {
+		if _, err := d.GetModelData(strings.Split(mapping, "/"), false); err == nil {
+			mappings = append(mappings, mapping)
+		}
+	}
+	sortPathsByDepth(mappings)
+
+	return results, d.Mqtt.PublishMappings(mappings, d.GetModelData)
+}
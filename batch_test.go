@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestApplyBatch(t *testing.T) {
+	operations := []BatchOperation{
+		{Op: "get", Path: "a"},
+		{Op: "set", Path: "a", Value: 2.0},
+		{Op: "get", Path: "/a/"},
+		{Op: "delete", Path: "b"},
+		{Op: "get", Path: "b"},
+		{Op: "rename", Path: "a"},
+	}
+
+	tests := []struct {
+		name       string
+		canWrite   bool
+		wantStatus []int
+		wantModel  string
+	}{
+		{"writer", true,
+			[]int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusBadRequest},
+			`{"a":2}`},
+		{"reader", false,
+			[]int{http.StatusOK, http.StatusForbidden, http.StatusOK, http.StatusForbidden, http.StatusOK, http.StatusBadRequest},
+			`{"a":1,"b":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, `{"model": {"a": 1, "b": 1}}`)
+
+			results, err := dataModel.ApplyBatch(operations, nil, tt.canWrite, nil, ChangeSource{Kind: SourceHTTP})
+			if err != nil {
+				t.Fatalf("ApplyBatch error = %v", err)
+			}
+			for i, result := range results {
+				if result.Status != tt.wantStatus[i] {
+					t.Errorf("operation %d (%s %s) status = %d, want %d: %s",
+						i, operations[i].Op, operations[i].Path, result.Status, tt.wantStatus[i], result.Error)
+				}
+			}
+
+			got, _ := json.Marshal(dataModel.Model)
+			if string(got) != tt.wantModel {
+				t.Errorf("model = %s, want %s", got, tt.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// BatchHandler handles requests to the batch endpoint, which performs several model operations at once
+func (s *Server) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+		return
+	}
+
+	jsonData, err := readJSONBody(w, r)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	items, ok := jsonData.([]any)
+	if !ok {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid batch: expected an array of operations"))
+		return
+	}
+
+	operations := make([]BatchOperation, 0, len(items))
+	for i, item := range items {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid batch: operation %d must be an object", i))
+			return
+		}
+
+		operation := BatchOperation{Value: itemMap["value"]}
+		if operation.Op, ok = itemMap["op"].(string); !ok {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid batch: operation %d must have an 'op'", i))
+			return
+		}
+		if operation.Path, ok = itemMap["path"].(string); !ok {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid batch: operation %d must have a 'path'", i))
+			return
+		}
+		operations = append(operations, operation)
+	}
+
+	// Without an ACL, batches only need the read role, and their writes need the write role
+	policy := accessPolicyFromRequest(r)
+	principal := principalFromRequest(r)
+	canWrite := policy != nil || principal == nil || principal.HasRole(RoleWrite)
+
+	results, err := s.dataModel.ApplyBatch(operations, policy, canWrite, s.limits.Load().writeThrottle(), httpSource(r))
+	if err != nil {
+		// The operations were applied, but not all changes could be published
+		log.Printf("Error publishing batch changes: %v", err)
+	}
+
+	sendJSONResponse(w, results, http.StatusOK)
+}
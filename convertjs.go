@@ -1,3 +1,5 @@
+//go:build !nov8
+
 package main
 
 import (
@@ -24,17 +26,20 @@ func ConvertGoToJavaScript(ctx *v8.Context, goObj any) (*v8.Value, error) {
 }
 
 func ConvertJavaScriptToGo(ctx *v8.Context, jsValue *v8.Value) (any, error) {
+	if jsValue.IsUndefined() || jsValue.IsNull() {
+		return nil, nil
+	}
+
 	// Step 1: Convert the JavaScript value to a JSON string
-	jsonStringScript := fmt.Sprintf("JSON.stringify(%s)", jsValue.String())
-	jsonValue, err := ctx.RunScript(jsonStringScript, "stringify.js")
-	if err != nil {
-		// Failed to convert: must be not be an object
+	jsonValue, err := v8.JSONStringify(ctx, jsValue)
+	if err != nil || jsonValue == "" || jsonValue == "undefined" {
+		// Failed to convert: must be not be serializable
 		return jsValue.String(), nil
 	}
 
 	// Step 2: Unmarshal the JSON string into the target Go object
 	var target any
-	err = json.Unmarshal([]byte(jsonValue.String()), &target)
+	err = json.Unmarshal([]byte(jsonValue), &target)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JavaScript value: %w", err)
 	}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the CORS configuration, covering the methods and headers the API uses
+var (
+	defaultCorsMethods        = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCorsHeaders        = []string{"Content-Type", "Authorization", "X-API-Key", "If-Match", "If-None-Match"}
+	defaultCorsExposedHeaders = []string{"ETag", "Last-Modified"}
+)
+
+// CorsConfig allows browser applications served from other origins to call the API
+type CorsConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`             // Origins like "https://dashboard.example.com", which may contain "*" globs
+	AllowedMethods   []string `json:"allowedMethods,omitempty"`   // Methods allowed in cross-origin requests, GET, POST, PUT and DELETE by default
+	AllowedHeaders   []string `json:"allowedHeaders,omitempty"`   // Request headers allowed in cross-origin requests, or "*" for any
+	ExposedHeaders   []string `json:"exposedHeaders,omitempty"`   // Response headers scripts may read, ETag and Last-Modified by default
+	AllowCredentials bool     `json:"allowCredentials,omitempty"` // Whether browsers may send cookies and client certificates
+	MaxAge           int      `json:"maxAge,omitempty"`           // Seconds browsers may cache preflight responses
+}
+
+// corsPolicy answers cross-origin requests as configured, with the header values prepared
+type corsPolicy struct {
+	origins          []string
+	anyOrigin        bool
+	methods          string
+	headers          string
+	anyHeader        bool
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+// newCorsPolicy checks the configuration and prepares its policy, which is nil if there is no configuration
+func newCorsPolicy(config *CorsConfig) (*corsPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if len(config.AllowedOrigins) == 0 {
+		return nil, fmt.Errorf("'cors' needs 'allowedOrigins'")
+	}
+	if config.MaxAge < 0 {
+		return nil, fmt.Errorf("'maxAge' can't be negative")
+	}
+
+	policy := &corsPolicy{
+		origins:          config.AllowedOrigins,
+		methods:          strings.Join(withDefault(config.AllowedMethods, defaultCorsMethods), ", "),
+		headers:          strings.Join(withDefault(config.AllowedHeaders, defaultCorsHeaders), ", "),
+		exposedHeaders:   strings.Join(withDefault(config.ExposedHeaders, defaultCorsExposedHeaders), ", "),
+		allowCredentials: config.AllowCredentials,
+	}
+	if config.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(config.MaxAge)
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+		} else if _, err := path.Match(origin, ""); err != nil {
+			return nil, fmt.Errorf("invalid origin glob '%s'", origin)
+		}
+	}
+	for _, header := range config.AllowedHeaders {
+		policy.anyHeader = policy.anyHeader || header == "*"
+	}
+
+	// Browsers reject credentialed responses that allow any origin, so this would only fail in confusing ways
+	if policy.anyOrigin && policy.allowCredentials {
+		return nil, fmt.Errorf("'allowCredentials' can't be used with the '*' origin")
+	}
+
+	return policy, nil
+}
+
+// withDefault returns the values, or the defaults if there are none
+func withDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// allowsOrigin reports whether requests from the origin are allowed
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	for _, pattern := range p.origins {
+		if matched, _ := path.Match(pattern, origin); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// setHeaders sets the response headers allowing a request from the origin, which must be allowed
+func (p *corsPolicy) setHeaders(w http.ResponseWriter, r *http.Request, origin string, preflight bool) {
+	header := w.Header()
+	if p.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		header.Set("Access-Control-Expose-Headers", p.exposedHeaders)
+		return
+	}
+
+	header.Set("Access-Control-Allow-Methods", p.methods)
+	if requested := r.Header.Get("Access-Control-Request-Headers"); p.anyHeader && requested != "" {
+		header.Set("Access-Control-Allow-Headers", requested)
+	} else {
+		header.Set("Access-Control-Allow-Headers", p.headers)
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+}
+
+// corsPolicy checks the server's CORS configuration, returning its policy, or nil if cross-origin requests aren't allowed
+func (c *ServerConfig) corsPolicy() (*corsPolicy, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	policy, err := newCorsPolicy(c.Cors)
+	if err != nil {
+		return nil, newError(ErrBadRequest, "invalid server config: %w", err)
+	}
+	return policy, nil
+}
+
+// withCors wraps the server's routes so that they answer preflight requests and allow the configured
+// cross-origin requests. Preflight requests don't carry credentials, so they are answered before authentication.
+func (s *Server) withCors(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := s.cors.Load()
+		origin := r.Header.Get("Origin")
+		if policy == nil || origin == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if policy.allowsOrigin(origin) {
+			policy.setHeaders(w, r, origin, preflight)
+		}
+
+		// Without the allow headers, browsers refuse to send the actual request
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewCorsPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *CorsConfig
+		wantErr bool
+	}{
+		{"no config", nil, false},
+		{"origins", &CorsConfig{AllowedOrigins: []string{"https://*.example.com"}}, false},
+		{"credentials with origins", &CorsConfig{AllowedOrigins: []string{"https://a.example.com"}, AllowCredentials: true}, false},
+		{"no origins", &CorsConfig{}, true},
+		{"negative max age", &CorsConfig{AllowedOrigins: []string{"*"}, MaxAge: -1}, true},
+		{"invalid glob", &CorsConfig{AllowedOrigins: []string{"https://[example.com"}}, true},
+		{"credentials with any origin", &CorsConfig{AllowedOrigins: []string{"https://a.example.com", "*"}, AllowCredentials: true}, true},
+	}
+
+	for _, tt := range tests {
+		if _, err := newCorsPolicy(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("%s: newCorsPolicy() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCorsPolicyAllowsOrigin(t *testing.T) {
+	policy, err := newCorsPolicy(&CorsConfig{AllowedOrigins: []string{"https://*.example.com", "http://localhost:3000"}})
+	if err != nil {
+		t.Fatalf("newCorsPolicy error = %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://dashboard.example.com", true},
+		{"http://localhost:3000", true},
+		{"https://example.com", false},
+		{"http://dashboard.example.com", false},
+		{"https://dashboard.example.com.evil.net", false},
+		{"http://localhost:3001", false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.allowsOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWithCors(t *testing.T) {
+	restricted := &CorsConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true, MaxAge: 600}
+	open := &CorsConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowedHeaders: []string{"*"}}
+
+	tests := []struct {
+		name        string
+		config      *CorsConfig
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantHeaders map[string]string // "" means the header must be missing
+	}{
+		{"preflight", restricted, http.MethodOptions, map[string]string{
+			"Origin": "https://dashboard.example.com", "Access-Control-Request-Method": "POST"},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":      "https://dashboard.example.com",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+				"Access-Control-Allow-Headers":     "Content-Type, Authorization, X-API-Key, If-Match, If-None-Match",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Expose-Headers":    "",
+			}},
+		{"preflight allowing any header", open, http.MethodOptions, map[string]string{
+			"Origin": "https://other.net", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Custom"},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Methods":     "GET",
+				"Access-Control-Allow-Headers":     "X-Custom",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "",
+			}},
+		{"preflight from disallowed origin", restricted, http.MethodOptions, map[string]string{
+			"Origin": "https://evil.net", "Access-Control-Request-Method": "POST"},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+				"Vary":                         "Origin",
+			}},
+		{"actual request", restricted, http.MethodGet, map[string]string{"Origin": "https://dashboard.example.com"},
+			http.StatusOK, map[string]string{
+				"Access-Control-Allow-Origin":   "https://dashboard.example.com",
+				"Access-Control-Expose-Headers": "ETag, Last-Modified",
+				"Access-Control-Allow-Methods":  "",
+				"Vary":                          "Origin",
+			}},
+		{"actual request from disallowed origin", restricted, http.MethodGet, map[string]string{"Origin": "https://evil.net"},
+			http.StatusOK, map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    "",
+			}},
+		{"same-origin request", restricted, http.MethodGet, nil,
+			http.StatusOK, map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""}},
+		{"cors disabled", nil, http.MethodOptions, map[string]string{
+			"Origin": "https://dashboard.example.com", "Access-Control-Request-Method": "POST"},
+			http.StatusOK, map[string]string{"Access-Control-Allow-Origin": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newCorsPolicy(tt.config)
+			if err != nil {
+				t.Fatalf("newCorsPolicy error = %v", err)
+			}
+			server := CreateServer(*NewDataModel())
+			server.cors.Store(policy)
+			handler := server.withCors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(tt.method, "/model", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
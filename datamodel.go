@@ -1,22 +1,48 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
-
-	v8 "rogchap.com/v8go"
+	"sync"
+	"time"
 )
 
 type DataModel struct {
-	Model           map[string]any      `json:"model"`           // Contains the current values for all topics
-	Transformations map[string]any      `json:"transformations"` // key: topic, value: transformation
-	Nodes           map[string][]string `json:"nodes"`           // key: datum ID, value: all associated topics
-	Mqtt            *MqttClient         `json:"mqtt"`            // MQTT client configuration
+	Model           map[string]any      `json:"model"`             // Contains the current values for all topics
+	Transformations map[string]any      `json:"transformations"`   // key: topic, value: transformation
+	Nodes           map[string][]string `json:"nodes"`             // key: datum ID, value: all associated topics
+	Mqtt            *MqttClient         `json:"mqtt"`              // MQTT client configuration
+	Auth            *AuthConfig         `json:"auth,omitempty"`    // Authentication of HTTP requests
+	Server          *ServerConfig       `json:"server,omitempty"`  // HTTP listeners
+	Audit           *AuditConfig        `json:"audit,omitempty"`   // Log of every change
+	Ttl             []TtlRule           `json:"ttl,omitempty"`     // Maximum ages of values before they are stale
+	History         *HistoryConfig      `json:"history,omitempty"` // Paths whose past values are kept
 
 	// Cache to prevent infinite recursion and improve performance
 	transformationCache map[string]any
 	processingPaths     map[string]bool
+	writingPaths        map[string]bool            // Paths whose onWrite scripts are running, to prevent them re-entering
+	dynamicDependencies map[string]map[string]bool // key: transformation path, value: paths read with model.get
+
+	// Console output and evaluation history of the transformations
+	diagnostics *diagnosticsStore
+
+	// Versions of the paths in the model, for conditional requests
+	versions *versionStore
+
+	// Record of the changes to the model and configuration
+	audit *auditLog
+
+	// When and where the values in the model came from
+	metadata *metadataStore
+
+	// Past values of the paths with a history
+	history *historyStore
+
+	// Serializes access between HTTP requests, MQTT messages and scheduled transformations
+	mu *sync.Mutex
 }
 
 // NewDataModel creates a new DataModel with initialized fields
@@ -28,6 +54,14 @@ func NewDataModel() *DataModel {
 		Mqtt:                nil,
 		transformationCache: make(map[string]any),
 		processingPaths:     make(map[string]bool),
+		writingPaths:        make(map[string]bool),
+		dynamicDependencies: make(map[string]map[string]bool),
+		diagnostics:         newDiagnosticsStore(),
+		versions:            newVersionStore(),
+		audit:               newAuditLog(),
+		metadata:            newMetadataStore(),
+		history:             newHistoryStore(),
+		mu:                  &sync.Mutex{},
 	}
 }
 
@@ -47,6 +81,59 @@ func (d *DataModel) ClearCache(paths ...string) {
 	}
 }
 
+// InvalidatePath clears the cached results of all transformations affected by a change at the path
+func (d *DataModel) InvalidatePath(path string) {
+	d.ClearCache(d.affectedTransformations(path)...)
+}
+
+// affectedTransformations returns the paths of the transformations whose result may change when the path changes:
+// transformations at, above or beneath the path, and transitively any transformations using those as parameters
+func (d *DataModel) affectedTransformations(path string) []string {
+	affected := make(map[string]bool)
+	changed := []string{path}
+
+	for len(changed) > 0 {
+		current := changed[0]
+		changed = changed[1:]
+
+		for transformPath := range d.Transformations {
+			if affected[transformPath] {
+				continue
+			}
+			if pathsOverlap(transformPath, current) || d.dependsOn(transformPath, current) {
+				affected[transformPath] = true
+				changed = append(changed, transformPath)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(affected))
+	for transformPath := range affected {
+		paths = append(paths, transformPath)
+	}
+	return paths
+}
+
+// dependsOn reports whether any of a transformation's parameters, or paths it read with model.get, overlap with the path
+func (d *DataModel) dependsOn(transformPath, path string) bool {
+	transformation, err := d.getTransformation(transformPath)
+	if err != nil || transformation == nil {
+		return false
+	}
+
+	for _, paramPath := range transformation.Parameters {
+		if pathsOverlap(paramPath, path) {
+			return true
+		}
+	}
+	for readPath := range d.dynamicDependencies[transformPath] {
+		if pathsOverlap(readPath, path) {
+			return true
+		}
+	}
+	return false
+}
+
 // applyTransformation applies a transformation to the given path and returns the result
 func (d *DataModel) applyTransformation(path string) (any, error) {
 	// Check if already in cache
@@ -56,7 +143,7 @@ func (d *DataModel) applyTransformation(path string) (any, error) {
 
 	// Check if we're already processing this path (to prevent infinite recursion)
 	if d.processingPaths[path] {
-		return nil, fmt.Errorf("potential circular dependency detected while processing '%s'", path)
+		return nil, newError(ErrTransformationFailed, "potential circular dependency detected while processing '%s'", path)
 	}
 
 	// Mark this path as being processed
@@ -66,153 +153,277 @@ func (d *DataModel) applyTransformation(path string) (any, error) {
 	// Split path into tokens
 	pathTokens := strings.Split(path, "/")
 
-	transformationAny, exists := d.Transformations[path]
-	if !exists {
+	transformation, err := d.getTransformation(path)
+	if err != nil {
+		return nil, wrapError(ErrTransformationFailed, err)
+	}
+	if transformation == nil || transformation.Implementation == "" {
 		// If no transformation exists, just return the raw value from the model
 		return GetMapData(&d.Model, pathTokens)
 	}
+	if transformation.Schedule != "" {
+		// Scheduled transformations store their result in the model when they run
+		return GetMapData(&d.Model, pathTokens)
+	}
 
-	// Cast the transformation to the expected format
-	transformation, ok := transformationAny.(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("invalid transformation format for path '%s': must be an object", path)
+	// Get the value the transformation applies to as "self"
+	selfValue, err := d.selfValue(path)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract implementation
-	implementation, ok := transformation["implementation"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid transformation format: missing or invalid 'implementation' field")
+	result, err := d.runScript(path, transformation, transformation.Implementation, selfValue)
+	if err != nil {
+		return nil, wrapError(ErrTransformationFailed, err)
 	}
 
-	// Extract parameters
-	parameters := make(map[string]string)
-	if params, ok := transformation["parameters"].(map[string]any); ok {
-		for k, v := range params {
-			if strVal, ok := v.(string); ok {
-				parameters[k] = strVal
-			} else {
-				return nil, fmt.Errorf("parameter '%s' must be a string", k)
-			}
+	// Cache the result, and keep it for the "last" error policy
+	d.transformationCache[path] = result
+	d.diagnostics.recordReadValue(path, result)
+
+	return result, nil
+}
+
+// transformedAncestor returns the nearest parent of the path with a transformation that applies to reads,
+// skipping parents that are currently being evaluated so that they can use their children as parameters
+func (d *DataModel) transformedAncestor(path string) (string, bool) {
+	pathTokens := strings.Split(path, "/")
+	for i := len(pathTokens) - 1; i > 0; i-- {
+		ancestor := strings.Join(pathTokens[:i], "/")
+		if d.hasReadTransformation(ancestor) && !d.processingPaths[ancestor] {
+			return ancestor, true
 		}
 	}
+	return "", false
+}
 
-	// Create the V8 environment
-	iso := v8.NewIsolate()
-	defer iso.Dispose()
-
-	// Create the global object template
-	global := v8.NewObjectTemplate(iso)
+// hasReadTransformation reports whether the path has a transformation that applies to reads
+func (d *DataModel) hasReadTransformation(path string) bool {
+	transformation, err := d.getTransformation(path)
+	return err == nil && transformation != nil && transformation.Implementation != ""
+}
 
-	// Create the context with the global template
-	ctx := v8.NewContext(iso, global)
-	defer ctx.Close()
+// selfValue returns the value a transformation at the path applies to: the value at the path within the output
+// of its nearest transformed parent if that contains it, or otherwise the value stored in the model
+func (d *DataModel) selfValue(path string) (any, error) {
+	if ancestor, ok := d.transformedAncestor(path); ok {
+		if ancestorValue, err := d.applyTransformation(ancestor); err == nil {
+			if value, found := LookupPath(ancestorValue, GetStrTokens(path, ancestor, "/")); found {
+				return value, nil
+			}
+		}
+	}
 
-	// Get the current raw value from the model as "self"
-	selfValue, err := GetMapData(&d.Model, pathTokens)
-	if err != nil && !strings.Contains(err.Error(), "not found") {
-		// Only return an error if it's not a "not found" error
-		return nil, fmt.Errorf("failed to get raw model data for 'self': %s", err.Error())
+	selfValue, err := GetMapData(&d.Model, strings.Split(path, "/"))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		// A missing value is a null "self" rather than an error
+		return nil, fmt.Errorf("failed to get raw model data for 'self': %w", err)
 	}
 
-	// Convert Go data to JavaScript object
-	jsInput, err := ConvertGoToJavaScript(ctx, selfValue)
+	return selfValue, nil
+}
+
+// runScript evaluates one of the scripts of the transformation at path with "self" and its parameters bound.
+// Console output is written to the server log and the transformation's diagnostics along with the outcome.
+func (d *DataModel) runScript(path string, transformation *Transformation, implementation string, selfValue any) (any, error) {
+	result, err := d.evaluateScript(path, transformation, implementation, selfValue)
+	d.diagnostics.recordResult(path, result, err)
+	return result, err
+}
+
+// evaluateScript resolves the input for a transformation script and runs it with its engine
+func (d *DataModel) evaluateScript(path string, transformation *Transformation, implementation string, selfValue any) (any, error) {
+	engine, err := getEngine(transformation.Engine)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert data to JavaScript object: %s", err.Error())
+		return nil, err
 	}
 
-	// Set the "self" variable in the global context
-	err = ctx.Global().Set("self", jsInput)
+	input, err := d.newScriptInput(transformation, implementation, selfValue, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set 'self' in global context: %s", err.Error())
+		return nil, err
+	}
+	input.Console = func(level, message string) {
+		d.diagnostics.logConsole(path, level, message)
 	}
 
-	// Set any parameters in the global context
-	for paramName, paramPath := range parameters {
+	// Track the paths read through the host so that changes to them invalidate the result
+	host := newTransformationHost(d, path, transformation)
+	input.Host = host
+	defer func() { d.dynamicDependencies[path] = host.reads }()
+
+	return engine.Run(input)
+}
+
+// newScriptInput resolves a transformation's parameters into the input for one of its scripts.
+// Parameters present in overrides use the given value instead of being resolved from the model.
+func (d *DataModel) newScriptInput(transformation *Transformation, implementation string, selfValue any, overrides map[string]any) (ScriptInput, error) {
+	parameters := make(map[string]any)
+	for paramName, paramPath := range transformation.Parameters {
+		if override, ok := overrides[paramName]; ok {
+			parameters[paramName] = override
+			continue
+		}
+
 		// Get the parameter value (which might involve recursively applying transformations)
 		paramValue, err := d.GetModelData(strings.Split(paramPath, "/"), false)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve parameter '%s' at path '%s': %s",
+			return ScriptInput{}, fmt.Errorf("failed to resolve parameter '%s' at path '%s': %s",
 				paramName, paramPath, err.Error())
 		}
+		parameters[paramName] = paramValue
+	}
 
-		// Convert parameter value to JavaScript
-		jsParamValue, err := ConvertGoToJavaScript(ctx, paramValue)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert parameter '%s' to JavaScript: %s",
-				paramName, err.Error())
-		}
+	return ScriptInput{
+		Implementation: implementation,
+		Self:           selfValue,
+		Parameters:     parameters,
+		Limits:         transformation.Limits,
+	}, nil
+}
 
-		// Set the parameter in the global context
-		err = ctx.Global().Set(paramName, jsParamValue)
-		if err != nil {
-			return nil, fmt.Errorf("failed to set parameter '%s' in global context: %s",
-				paramName, err.Error())
-		}
+// ReadOptions control how the model is read by GetModelDataWithOptions
+type ReadOptions struct {
+	Raw          bool // Return the stored values without applying transformations
+	InlineErrors bool // Replace failed transformations with error objects instead of applying their onError policy
+}
+
+// TransformationErrorValue takes the place of a failed transformation's value when reading with InlineErrors
+type TransformationErrorValue struct {
+	Error  string `json:"error"`
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// transformationResult applies the transformation at the path, handling failures according to its onError policy.
+// The returned bool is false if the value should be left out of the result.
+func (d *DataModel) transformationResult(path string, inlineErrors bool) (any, bool, error) {
+	value, err := d.applyTransformation(path)
+	if err == nil {
+		return value, true, nil
 	}
 
-	// Run the transformation script
-	jsResult, err := ctx.RunScript(implementation, "transformation.js")
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute JavaScript: %s", err.Error())
+	if inlineErrors {
+		errorValue := TransformationErrorValue{Error: err.Error(), Path: path}
+		var scriptErr *ScriptError
+		if errors.As(err, &scriptErr) {
+			errorValue.Line, errorValue.Column = scriptErr.Line, scriptErr.Column
+		}
+		return errorValue, true, nil
 	}
 
-	result, err := ConvertJavaScriptToGo(ctx, jsResult)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert JavaScript result to Go object: %s", err.Error())
+	transformation, parseErr := d.getTransformation(path)
+	if parseErr != nil || transformation == nil {
+		transformation = &Transformation{}
 	}
 
-	// Cache the result
-	d.transformationCache[path] = result
+	if transformation.OnError == OnErrorPropagate {
+		return nil, false, newError(ErrTransformationFailed, "transformation for '%s' failed: %w", path, err)
+	}
 
-	return result, nil
+	log.Printf("INFO: Failed to apply transformation for '%s': %s", path, err.Error())
+
+	switch transformation.OnError {
+	case OnErrorOmit:
+		return nil, false, nil
+	case OnErrorLast:
+		lastValue, _ := d.diagnostics.lastReadValue(path)
+		return lastValue, true, nil
+	case OnErrorFallback:
+		return transformation.Fallback, true, nil
+	default:
+		return nil, true, nil
+	}
 }
 
-// applyNestedTransformations applies transformations to all children of a path
-func (d *DataModel) applyNestedTransformations(path string, rawData any) (any, error) {
-	// If the data is not a map, no transformations to apply
-	resultMap, isMap := rawData.(map[string]any)
-	if !isMap {
-		return d.applyTransformation(path)
-	}
+// applyNestedTransformations reads the path from the model with the transformations at and beneath it applied.
+//
+// Transformations are applied parents first, so the output of a transformation forms the base that the
+// transformations of its children are applied on top of. Paths beneath a transformation read from its output.
+func (d *DataModel) applyNestedTransformations(path string, inlineErrors bool) (any, error) {
+	// Paths beneath a transformed parent are read from the parent's output
+	if ancestor, ok := d.transformedAncestor(path); ok {
+		ancestorData, err := d.applyNestedTransformations(ancestor, inlineErrors)
+		if err != nil {
+			return nil, err
+		}
 
-	// Create a copy of the map to avoid modifying the original
-	resultCopy := make(map[string]any)
-	for k, v := range resultMap {
-		resultCopy[k] = v
+		value, found := LookupPath(ancestorData, GetStrTokens(path, ancestor, "/"))
+		if !found {
+			return nil, newError(ErrNotFound, "path '%s' not found in the output of the transformation for '%s'", path, ancestor)
+		}
+		return value, nil
 	}
 
-	// Look for transformations that should be applied to children
+	rawData, rawErr := GetMapData(&d.Model, GetStrTokens(path, "", "/"))
+
+	// Look for transformations at or beneath the path, parents first
+	var transformPaths []string
 	for transformPath := range d.Transformations {
-		if strings.HasPrefix(transformPath, path) {
-			transformedValue, err := d.applyTransformation(transformPath)
-			if err != nil {
-				log.Printf("INFO: Failed to apply transformation for '%s': %s", transformPath, err.Error())
+		// Transformations that only condition writes don't contribute to reads
+		if isSubPath(transformPath, path) && d.hasReadTransformation(transformPath) {
+			transformPaths = append(transformPaths, transformPath)
+		}
+	}
+	sortPathsByDepth(transformPaths)
+
+	if len(transformPaths) == 0 {
+		return rawData, rawErr
+	}
+
+	// Copy the data to avoid modifying the model or the cached transformation results
+	result := DeepCopyValue(rawData)
+
+	for _, transformPath := range transformPaths {
+		transformedValue, include, err := d.transformationResult(transformPath, inlineErrors)
+		if err != nil {
+			return nil, err
+		}
+		transformedValue = DeepCopyValue(transformedValue)
+
+		// The transformation at the path itself replaces the data
+		subPathTokens := GetStrTokens(transformPath, path, "/")
+		if len(subPathTokens) == 0 {
+			if !include {
+				return nil, newError(ErrNotFound, "path '%s' not found: its transformation failed", path)
 			}
+			result = transformedValue
+			continue
+		}
 
-			// Update the result with the transformed value
-			subPathTokens := GetStrTokens(transformPath, path, "/")
-			SetMapData(&resultCopy, subPathTokens, transformedValue)
+		// Children of a value that isn't an object replace it with one
+		resultMap, ok := result.(map[string]any)
+		if !ok {
+			resultMap = make(map[string]any)
+			result = resultMap
+		}
+
+		// Update the result with the transformed value
+		if include {
+			SetMapData(&resultMap, subPathTokens, transformedValue)
+		} else {
+			DeleteMapData(&resultMap, subPathTokens)
 		}
 	}
 
-	return resultCopy, nil
+	return result, nil
 }
 
 // GetModelData gets data from the model, applying transformations as needed
 func (d *DataModel) GetModelData(pathTokens []string, raw bool) (any, error) {
-	rawData, err := GetMapData(&d.Model, pathTokens)
-	if raw && err != nil {
-		// Ok if not raw since it might be a synthetic data point
-		return nil, err
-	}
+	return d.GetModelDataWithOptions(pathTokens, ReadOptions{Raw: raw})
+}
 
-	if raw {
-		return rawData, nil
+// GetModelDataWithOptions gets data from the model as specified by the options
+func (d *DataModel) GetModelDataWithOptions(pathTokens []string, options ReadOptions) (any, error) {
+	if options.Raw {
+		return GetMapData(&d.Model, pathTokens)
 	}
 
 	path := strings.Join(pathTokens, "/")
 
-	transformedData, err := d.applyNestedTransformations(path, rawData)
+	// Missing paths are ok since they might be synthetic data points
+	transformedData, err := d.applyNestedTransformations(path, options.InlineErrors)
 	if err != nil {
 		return nil, err
 	}
@@ -220,20 +431,128 @@ func (d *DataModel) GetModelData(pathTokens []string, raw bool) (any, error) {
 	return transformedData, nil
 }
 
-// SetModelData sets data in the model without applying transformations
-func (d *DataModel) SetModelData(pathTokens []string, value any, fromMqtt bool) error {
-	// Clear the transformation cache since model data is changing
-	d.ClearCache(strings.Join(pathTokens, "/"))
-	err := SetMapData(&d.Model, pathTokens, value)
-	if err != nil {
-		return err
+// applyWriteTransformations runs the onWrite scripts of the path and any of its children on an incoming value
+func (d *DataModel) applyWriteTransformations(path string, value any) (any, error) {
+	// Collect the onWrite transformations at or beneath the path, parents first
+	var writePaths []string
+	for transformPath := range d.Transformations {
+		if isSubPath(transformPath, path) {
+			writePaths = append(writePaths, transformPath)
+		}
 	}
+	sortPathsByDepth(writePaths)
 
-	if !fromMqtt && d.Mqtt != nil {
-		err = d.Mqtt.PublishMessage(pathTokens, d.GetModelData)
+	// Copy the value so that values shared between several paths (e.g. nodes) aren't modified
+	if valueMap, ok := value.(map[string]any); ok {
+		value = DeepCopyMap(valueMap)
+	}
+
+	for _, writePath := range writePaths {
+		transformation, err := d.getTransformation(writePath)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if transformation.OnWrite == "" {
+			continue
+		}
+
+		// The incoming value for a child path is found inside the written object
+		subPathTokens := GetStrTokens(writePath, path, "/")
+		if writePath == path {
+			subPathTokens = []string{}
+		}
+		var incoming any = value
+		if len(subPathTokens) > 0 {
+			valueMap, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			if incoming, err = GetMapData(&valueMap, subPathTokens); err != nil {
+				continue // Child isn't part of this write
+			}
+		}
+
+		// An onWrite script writing to its own path, directly or through other onWrite scripts, would never end
+		if d.writingPaths[writePath] {
+			return nil, newError(ErrValueRejected, "value for '%s' rejected: its onWrite transformation is already running", writePath)
+		}
+		d.writingPaths[writePath] = true
+		converted, err := d.runScript(writePath, transformation, transformation.OnWrite, incoming)
+		delete(d.writingPaths, writePath)
+		if err != nil {
+			return nil, newError(ErrValueRejected, "value for '%s' rejected by onWrite: %w", writePath, err)
+		}
+
+		if len(subPathTokens) == 0 {
+			value = converted
+		} else {
+			valueMap := value.(map[string]any)
+			SetMapData(&valueMap, subPathTokens, converted)
 		}
 	}
+
+	return value, nil
+}
+
+// SetModelData sets data in the model without applying transformations, and publishes it over MQTT
+// unless it came from there
+func (d *DataModel) SetModelData(pathTokens []string, value any, source ChangeSource) error {
+	if err := d.storeModelData(pathTokens, value, source); err != nil {
+		return err
+	}
+
+	if source.Kind != SourceMqtt && d.Mqtt != nil {
+		return d.Mqtt.PublishMessage(pathTokens, d.GetModelData)
+	}
+	return nil
+}
+
+// storeModelData writes a value to the model after its onWrite transformations, without publishing it
+func (d *DataModel) storeModelData(pathTokens []string, value any, source ChangeSource) error {
+	// Validate and convert the incoming value before it is stored
+	value, err := d.applyWriteTransformations(strings.Join(pathTokens, "/"), value)
+	if err != nil {
+		return err
+	}
+	return d.writeModelData(pathTokens, value, source)
+}
+
+// writeModelData writes a value to the model as it is, recording its version, metadata, history and audit entry,
+// without publishing it
+func (d *DataModel) writeModelData(pathTokens []string, value any, source ChangeSource) error {
+	// Clear the affected transformation results since model data is changing
+	d.InvalidatePath(strings.Join(pathTokens, "/"))
+	oldValue, _ := LookupPath(d.Model, pathTokens)
+	if err := SetMapData(&d.Model, pathTokens, value); err != nil {
+		return err
+	}
+	d.versions.changed(strings.Join(pathTokens, "/"))
+	d.metadata.record(strings.Join(pathTokens, "/"), oldValue, value, newValueMetadata(source))
+	d.history.record(strings.Join(pathTokens, "/"), value, time.Now())
+
+	// Values are replaced rather than changed in place, so the old value is still intact
+	d.audit.record(AuditEntry{Time: time.Now(), Action: "set", Path: strings.Join(pathTokens, "/"),
+		OldValue: oldValue, NewValue: value, Source: source})
+
+	return nil
+}
+
+// deleteModelData removes a path from the model, without publishing the change
+func (d *DataModel) deleteModelData(pathTokens []string, source ChangeSource) error {
+	if len(pathTokens) == 0 {
+		return newError(ErrBadRequest, "the root of the model can't be deleted")
+	}
+	oldValue, found := LookupPath(d.Model, pathTokens)
+	if !found {
+		return newError(ErrNotFound, "path '%s' not found", strings.Join(pathTokens, "/"))
+	}
+
+	d.InvalidatePath(strings.Join(pathTokens, "/"))
+	DeleteMapData(&d.Model, pathTokens)
+	d.versions.changed(strings.Join(pathTokens, "/"))
+	d.metadata.forget(strings.Join(pathTokens, "/"), oldValue)
+	d.audit.record(AuditEntry{Time: time.Now(), Action: "delete", Path: strings.Join(pathTokens, "/"),
+		OldValue: oldValue, Source: source})
+
 	return nil
 }
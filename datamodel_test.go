@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestDataModel creates a data model from a config.json document
+func newTestDataModel(t *testing.T, config string) *DataModel {
+	t.Helper()
+	dataModel := NewDataModel()
+	if err := json.Unmarshal([]byte(config), dataModel); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+	return dataModel
+}
+
+func TestNestedTransformations(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		path    string
+		want    string // JSON of the value read, if the read succeeds
+		wantErr *ErrorKind
+	}{
+		{
+			name: "child runs on the parent's output",
+			config: `{"model": {"room": {"temp": 20}}, "transformations": {
+				"room": {"implementation": "({temp: self.temp, temp_f: self.temp * 9 / 5 + 32.4})"},
+				"room/temp_f": {"implementation": "Math.round(self)"}}}`,
+			path: "room",
+			want: `{"temp":20,"temp_f":68}`,
+		},
+		{
+			name: "child read directly still runs on the parent's output",
+			config: `{"model": {"room": {"temp": 20}}, "transformations": {
+				"room": {"implementation": "({temp: self.temp, temp_f: self.temp * 9 / 5 + 32.4})"},
+				"room/temp_f": {"implementation": "Math.round(self)"}}}`,
+			path: "room/temp_f",
+			want: `68`,
+		},
+		{
+			name: "grandchild runs on the child's output",
+			config: `{"model": {"a": {"b": {"c": 1}}}, "transformations": {
+				"a": {"implementation": "({b: {c: self.b.c + 1}})"},
+				"a/b": {"implementation": "({c: self.c * 10})"},
+				"a/b/c": {"implementation": "self + 3"}}}`,
+			path: "a",
+			want: `{"b":{"c":23}}`,
+		},
+		{
+			name: "child uses the stored value if the parent's output doesn't contain it",
+			config: `{"model": {"room": {"temp": 20, "humidity": 40}}, "transformations": {
+				"room": {"implementation": "({temp: self.temp})"},
+				"room/humidity": {"implementation": "self + 1"}}}`,
+			path: "room/humidity",
+			want: `41`,
+		},
+		{
+			name: "stored values the parent leaves out aren't visible",
+			config: `{"model": {"room": {"temp": 20, "humidity": 40}}, "transformations": {
+				"room": {"implementation": "({temp: self.temp})"}}}`,
+			path:    "room/humidity",
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "parent reads a child parameter without its own output applied",
+			config: `{"model": {"room": {"temp": 20}}, "transformations": {
+				"room": {"implementation": "({temp: t * 2})", "parameters": {"t": "room/temp"}}}}`,
+			path: "room",
+			want: `{"temp":40}`,
+		},
+		{
+			name: "parent's output forms the base of a transformed subtree read",
+			config: `{"model": {"room": {"temp": 20}}, "transformations": {
+				"room": {"implementation": "({temp: self.temp, label: 'warm'})"},
+				"room/label": {"implementation": "self.toUpperCase()"}}}`,
+			path: "room",
+			want: `{"label":"WARM","temp":20}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, tt.config)
+
+			got, err := dataModel.GetModelData(strings.Split(tt.path, "/"), false)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetModelData(%q) error = %v, want %s", tt.path, err, tt.wantErr.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetModelData(%q) error = %v", tt.path, err)
+			}
+
+			gotJson, _ := json.Marshal(got)
+			if string(gotJson) != tt.want {
+				t.Errorf("GetModelData(%q) = %s, want %s", tt.path, gotJson, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedTransformationsCacheChildrenSeparately(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"room": {"temp": 20, "other": 1}}, "transformations": {
+		"room/temp": {"implementation": "self * 2"},
+		"room/other": {"implementation": "self + 1"}}}`)
+
+	if _, err := dataModel.GetModelData([]string{"room"}, false); err != nil {
+		t.Fatalf("GetModelData error = %v", err)
+	}
+	if _, ok := dataModel.transformationCache["room/other"]; !ok {
+		t.Fatal("result of 'room/other' wasn't cached")
+	}
+
+	if err := dataModel.SetModelData([]string{"room", "temp"}, 30.0, ChangeSource{Kind: SourceHTTP}); err != nil {
+		t.Fatalf("SetModelData error = %v", err)
+	}
+	if _, ok := dataModel.transformationCache["room/temp"]; ok {
+		t.Error("result of 'room/temp' is still cached after its value changed")
+	}
+	if _, ok := dataModel.transformationCache["room/other"]; !ok {
+		t.Error("result of 'room/other' was invalidated by a change to 'room/temp'")
+	}
+
+	got, err := dataModel.GetModelData([]string{"room", "temp"}, false)
+	if err != nil {
+		t.Fatalf("GetModelData error = %v", err)
+	}
+	if got != 60.0 {
+		t.Errorf("GetModelData(room/temp) = %v, want 60", got)
+	}
+}
+
+func TestSelfValue(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"a": {"b": 1}}}`)
+
+	// Missing values are a null "self" rather than an error
+	tests := []struct {
+		path string
+		want any
+	}{
+		{"a/b", 1.0},
+		{"a/missing", nil},
+		{"missing/path", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := dataModel.selfValue(tt.path)
+		if err != nil {
+			t.Errorf("selfValue(%q) error = %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("selfValue(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOnWriteReentry(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		path    string
+		want    string // JSON of the model after the write
+		wantErr *ErrorKind
+	}{
+		{
+			name: "script writing to another path",
+			config: `{"model": {"a": 0, "b": 0}, "transformations": {
+				"a": {"onWrite": "model.set('b', self * 2), self", "allowWrites": true}}}`,
+			path: "a",
+			want: `{"a":1,"b":2}`,
+		},
+		{
+			name: "script writing to its own path",
+			config: `{"model": {"a": 0}, "transformations": {
+				"a": {"onWrite": "model.set('a', self + 1), self", "allowWrites": true}}}`,
+			path:    "a",
+			want:    `{"a":0}`,
+			wantErr: ErrValueRejected,
+		},
+		{
+			name: "scripts writing to each other's paths",
+			config: `{"model": {"b": 0, "c": 0}, "transformations": {
+				"b": {"onWrite": "model.set('c', self), self", "allowWrites": true},
+				"c": {"onWrite": "model.set('b', self), self", "allowWrites": true}}}`,
+			path:    "b",
+			want:    `{"b":0,"c":0}`,
+			wantErr: ErrValueRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, tt.config)
+
+			err := dataModel.SetModelData(strings.Split(tt.path, "/"), 1.0, ChangeSource{Kind: SourceHTTP})
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetModelData(%q) error = %v, want %s", tt.path, err, tt.wantErr.Code)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("SetModelData(%q) error = %v", tt.path, err)
+			}
+			if len(dataModel.writingPaths) != 0 {
+				t.Errorf("writingPaths = %v after the write, want none", dataModel.writingPaths)
+			}
+
+			got, _ := json.Marshal(dataModel.Model)
+			if string(got) != tt.want {
+				t.Errorf("model = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnErrorLast(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"x": 1}, "transformations": {
+		"x": {"implementation": "self > 100 ? notDefined : self * 10", "onWrite": "self * 2", "onError": "last"}}}`)
+
+	read := func() any {
+		t.Helper()
+		value, err := dataModel.GetModelData([]string{"x"}, false)
+		if err != nil {
+			t.Fatalf("GetModelData error = %v", err)
+		}
+		return value
+	}
+	write := func(value float64) {
+		t.Helper()
+		if err := dataModel.SetModelData([]string{"x"}, value, ChangeSource{Kind: SourceHTTP}); err != nil {
+			t.Fatalf("SetModelData error = %v", err)
+		}
+	}
+
+	if got := read(); got != 10.0 {
+		t.Fatalf("read = %v, want 10", got)
+	}
+
+	// The onWrite result 400 isn't a read result, so failing reads keep returning the last good read
+	write(200)
+	if got := read(); got != 10.0 {
+		t.Errorf("failing read = %v, want the last good read 10", got)
+	}
+
+	write(3)
+	if got := read(); got != 60.0 {
+		t.Errorf("read = %v, want 60", got)
+	}
+	write(100)
+	if got := read(); got != 60.0 {
+		t.Errorf("failing read = %v, want the last good read 60", got)
+	}
+}
+
+func TestOnWriteTransformations(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		path    string
+		value   string
+		want    string // JSON of the model after the write
+		wantErr *ErrorKind
+	}{
+		{
+			name: "converts the stored value",
+			config: `{"model": {"temp": {"c": 0}}, "transformations": {
+				"temp/c": {"onWrite": "(self - 32) * 5 / 9"}}}`,
+			path:  "temp/c",
+			value: `212`,
+			want:  `{"temp":{"c":100}}`,
+		},
+		{
+			name: "uses parameters",
+			config: `{"model": {"offset": 5, "level": 0}, "transformations": {
+				"level": {"onWrite": "self + offset", "parameters": {"offset": "offset"}}}}`,
+			path:  "level",
+			value: `10`,
+			want:  `{"level":15,"offset":5}`,
+		},
+		{
+			name: "runs for children of a written object",
+			config: `{"model": {"switch": {"state": false, "name": "pump"}}, "transformations": {
+				"switch/state": {"onWrite": "self === 'ON'"}}}`,
+			path:  "switch",
+			value: `{"state": "ON", "name": "pump"}`,
+			want:  `{"switch":{"name":"pump","state":true}}`,
+		},
+		{
+			name: "runs parents first",
+			config: `{"model": {}, "transformations": {
+				"a": {"onWrite": "({b: self.b + 1})"},
+				"a/b": {"onWrite": "self * 10"}}}`,
+			path:  "a",
+			value: `{"b": 1}`,
+			want:  `{"a":{"b":20}}`,
+		},
+		{
+			name: "skips children missing from the write",
+			config: `{"model": {"switch": {"state": false}}, "transformations": {
+				"switch/state": {"onWrite": "self === 'ON'"}}}`,
+			path:  "switch",
+			value: `{"name": "pump"}`,
+			want:  `{"switch":{"name":"pump"}}`,
+		},
+		{
+			name: "rejects values the script throws on",
+			config: `{"model": {"temp": 20}, "transformations": {
+				"temp": {"onWrite": "if (typeof self !== 'number') throw new Error('expected a number'); self"}}}`,
+			path:    "temp",
+			value:   `"warm"`,
+			want:    `{"temp":20}`,
+			wantErr: ErrValueRejected,
+		},
+		{
+			name: "rejects values for a child the script throws on",
+			config: `{"model": {"room": {"temp": 20, "name": "lab"}}, "transformations": {
+				"room/temp": {"onWrite": "if (self > 50) throw new Error('too hot'); self"}}}`,
+			path:    "room",
+			value:   `{"temp": 80, "name": "kitchen"}`,
+			want:    `{"room":{"name":"lab","temp":20}}`,
+			wantErr: ErrValueRejected,
+		},
+		{
+			name: "rejects values if the script doesn't compile",
+			config: `{"model": {"temp": 20}, "transformations": {
+				"temp": {"onWrite": "self +"}}}`,
+			path:    "temp",
+			value:   `21`,
+			want:    `{"temp":20}`,
+			wantErr: ErrValueRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, tt.config)
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("invalid test value: %v", err)
+			}
+
+			err := dataModel.SetModelData(strings.Split(tt.path, "/"), value, ChangeSource{Kind: SourceHTTP})
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetModelData(%q) error = %v, want %s", tt.path, err, tt.wantErr.Code)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("SetModelData(%q) error = %v", tt.path, err)
+			}
+
+			got, _ := json.Marshal(dataModel.Model)
+			if string(got) != tt.want {
+				t.Errorf("model = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
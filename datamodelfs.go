@@ -27,21 +27,28 @@ func initDataModelFromFile(path string) (DataModel, error) {
 	return *dataModel, nil
 }
 
-// LoadDataModel initializes a data model from the file path CONFIG_FILE_PATH, or config.json if empty.
-func LoadDataModel() (DataModel, error) {
-	path := os.Getenv("CONFIG_FILE_PATH")
-	if path != "" {
-		return initDataModelFromFile(path)
+// configFilePath returns the file path CONFIG_FILE_PATH, or config.json if empty
+func configFilePath() string {
+	if path := os.Getenv("CONFIG_FILE_PATH"); path != "" {
+		return path
 	}
+	return "config.json"
+}
 
-	dataModel, err := initDataModelFromFile("config.json")
+// LoadDataModel initializes a data model from the file path CONFIG_FILE_PATH, or config.json if empty.
+func LoadDataModel() (DataModel, error) {
+	dataModel, err := initDataModelFromFile(configFilePath())
 	if err != nil {
 		return dataModel, err
 	}
 
 	if dataModel.Mqtt != nil {
 		dataModel.Mqtt.Connect()
-		dataModel.Mqtt.SetupSubscriptions(dataModel.SetModelData)
+		dataModel.Mqtt.SetupSubscriptions(func(pathTokens []string, value any, source ChangeSource) error {
+			dataModel.mu.Lock()
+			defer dataModel.mu.Unlock()
+			return dataModel.SetModelData(pathTokens, value, source)
+		})
 	}
 
 	return dataModel, err
@@ -49,15 +56,10 @@ func LoadDataModel() (DataModel, error) {
 
 // SaveDataModel saves the model to the file path CONFIG_FILE_PATH, or config.json if empty.
 func SaveDataModel(dataModel DataModel) error {
-	path := os.Getenv("CONFIG_FILE_PATH")
-	if path == "" {
-		path = "config.json"
-	}
-
 	data, err := json.Marshal(dataModel)
 	if err != nil {
 		return fmt.Errorf("error marshaling data model to JSON: %s", err.Error())
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return os.WriteFile(configFilePath(), data, 0644)
 }
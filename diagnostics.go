@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// maxConsoleEntries is the number of console messages retained for each transformation
+const maxConsoleEntries = 100
+
+// TransformationDiagnostics records the recent activity of a transformation for debugging
+type TransformationDiagnostics struct {
+	Console       []ConsoleEntry `json:"console"`                 // Most recent console messages, oldest first
+	LastError     string         `json:"lastError,omitempty"`     // Message of the most recent failure, until the next success
+	LastErrorTime *time.Time     `json:"lastErrorTime,omitempty"` // Time of the most recent failure, until the next success
+	LastSuccess   *time.Time     `json:"lastSuccess,omitempty"`   // Time of the most recent successful evaluation
+	LastValue     any            `json:"lastValue,omitempty"`     // Result of the most recent successful evaluation
+}
+
+// diagnosticsStore holds the diagnostics of all transformations, keyed by path
+type diagnosticsStore struct {
+	mu         sync.Mutex
+	entries    map[string]*TransformationDiagnostics
+	readValues map[string]any // key: path, value: result of the most recent successful evaluation for a read
+}
+
+func newDiagnosticsStore() *diagnosticsStore {
+	return &diagnosticsStore{
+		entries:    make(map[string]*TransformationDiagnostics),
+		readValues: make(map[string]any),
+	}
+}
+
+// entry returns the diagnostics for a path, creating them if needed. The caller must hold the lock.
+func (s *diagnosticsStore) entry(path string) *TransformationDiagnostics {
+	diagnostics, exists := s.entries[path]
+	if !exists {
+		diagnostics = &TransformationDiagnostics{Console: []ConsoleEntry{}}
+		s.entries[path] = diagnostics
+	}
+	return diagnostics
+}
+
+// logConsole writes a console message from a transformation to the server log and its console buffer
+func (s *diagnosticsStore) logConsole(path, level, message string) {
+	log.Printf("Transformation '%s' console.%s: %s", path, level, message)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	diagnostics := s.entry(path)
+	diagnostics.Console = append(diagnostics.Console, ConsoleEntry{Level: level, Message: message, Time: time.Now()})
+	if overflow := len(diagnostics.Console) - maxConsoleEntries; overflow > 0 {
+		diagnostics.Console = diagnostics.Console[overflow:]
+	}
+}
+
+// recordResult records the outcome of evaluating a transformation
+func (s *diagnosticsStore) recordResult(path string, result any, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	diagnostics := s.entry(path)
+	if err != nil {
+		diagnostics.LastError = err.Error()
+		diagnostics.LastErrorTime = &now
+	} else {
+		// The transformation works again, so the error no longer applies
+		diagnostics.LastError = ""
+		diagnostics.LastErrorTime = nil
+		diagnostics.LastSuccess = &now
+		diagnostics.LastValue = result
+	}
+}
+
+// recordReadValue records the result of evaluating a transformation's implementation for a read. Unlike the
+// results of its onWrite script, these are what reads return.
+func (s *diagnosticsStore) recordReadValue(path string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readValues[path] = value
+}
+
+// lastReadValue returns the result of the most recent successful evaluation of a transformation for a read
+func (s *diagnosticsStore) lastReadValue(path string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, exists := s.readValues[path]
+	return value, exists
+}
+
+// get returns a copy of the diagnostics for a path
+func (s *diagnosticsStore) get(path string) (TransformationDiagnostics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	diagnostics, exists := s.entries[path]
+	if !exists {
+		return TransformationDiagnostics{}, false
+	}
+
+	snapshot := *diagnostics
+	snapshot.Console = append([]ConsoleEntry{}, diagnostics.Console...)
+	return snapshot, true
+}
+
+// all returns a copy of the diagnostics for every transformation that has been evaluated
+func (s *diagnosticsStore) all() map[string]TransformationDiagnostics {
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.entries))
+	for path := range s.entries {
+		paths = append(paths, path)
+	}
+	s.mu.Unlock()
+
+	result := make(map[string]TransformationDiagnostics)
+	for _, path := range paths {
+		if diagnostics, ok := s.get(path); ok {
+			result[path] = diagnostics
+		}
+	}
+	return result
+}
+
+// remove discards the diagnostics for a path
+func (s *diagnosticsStore) remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, path)
+	delete(s.readValues, path)
+}
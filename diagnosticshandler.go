@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// DiagnosticsHandler handles requests to the diagnostics endpoint, which reports the
+// console output, last error and last successful evaluation of transformations
+func (s *Server) DiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+		return
+	}
+
+	path := strings.Join(extractPathTokens(r.URL.Path, "/diagnostics"), "/")
+	if path == "" {
+		sendJSONResponse(w, s.dataModel.diagnostics.all(), http.StatusOK)
+		return
+	}
+
+	if _, exists := s.dataModel.Transformations[path]; !exists {
+		sendErrorResponse(w, r, newError(ErrNotFound, "transformation '%s' not found", path))
+		return
+	}
+
+	// Transformations that haven't been evaluated yet have empty diagnostics
+	diagnostics, exists := s.dataModel.diagnostics.get(path)
+	if !exists {
+		diagnostics = TransformationDiagnostics{Console: []ConsoleEntry{}}
+	}
+
+	sendJSONResponse(w, diagnostics, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticsFollowResults(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"line": {"speed": 3}}, "transformations": {
+		"line/speed": {"implementation": "console.log('speed', self); if (self < 0) throw new Error('negative speed'); self"}}}`)
+	server := CreateServer(*dataModel)
+
+	diagnostics := func() TransformationDiagnostics {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/diagnostics/line/speed", nil)
+		w := httptest.NewRecorder()
+		server.DiagnosticsHandler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /diagnostics/line/speed status = %d: %s", w.Code, w.Body)
+		}
+		var result TransformationDiagnostics
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("invalid diagnostics: %v", err)
+		}
+		return result
+	}
+	read := func(speed float64) {
+		t.Helper()
+		if err := dataModel.SetModelData([]string{"line", "speed"}, speed, ChangeSource{Kind: SourceHTTP}); err != nil {
+			t.Fatalf("SetModelData error = %v", err)
+		}
+		dataModel.GetModelData([]string{"line", "speed"}, false)
+	}
+
+	// Transformations that haven't been evaluated have empty diagnostics
+	if got := diagnostics(); len(got.Console) != 0 || got.LastSuccess != nil || got.LastError != "" {
+		t.Errorf("diagnostics before evaluation = %+v, want none", got)
+	}
+
+	start := time.Now()
+	read(-1)
+	failed := diagnostics()
+	if failed.LastError == "" || failed.LastErrorTime == nil || failed.LastErrorTime.Before(start) {
+		t.Errorf("diagnostics after a failure = %+v, want the error and its time", failed)
+	}
+	if failed.LastSuccess != nil {
+		t.Errorf("lastSuccess after a failure = %v, want none", failed.LastSuccess)
+	}
+	if len(failed.Console) != 1 || failed.Console[0].Message != "speed -1" {
+		t.Errorf("console after a failure = %+v, want the failed run's message", failed.Console)
+	}
+
+	read(4)
+	succeeded := diagnostics()
+	if succeeded.LastError != "" || succeeded.LastErrorTime != nil {
+		t.Errorf("error after a success = %q at %v, want it cleared", succeeded.LastError, succeeded.LastErrorTime)
+	}
+	if succeeded.LastSuccess == nil || succeeded.LastValue != 4.0 {
+		t.Errorf("diagnostics after a success = %+v, want its time and value", succeeded)
+	}
+	if len(succeeded.Console) != 2 {
+		t.Errorf("console after a success = %+v, want both runs' messages", succeeded.Console)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/diagnostics/line/missing", nil)
+	w := httptest.NewRecorder()
+	server.DiagnosticsHandler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /diagnostics/line/missing status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestDiagnosticsRequireAdmin(t *testing.T) {
+	t.Setenv("API_KEYS", "")
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_JWKS_FILE", "")
+
+	authenticator, err := NewAuthenticator(&AuthConfig{ApiKeys: []ApiKey{
+		{Name: "panel", Key: "read-key", Roles: []string{RoleRead, RoleWrite}},
+		{Name: "ops", Key: "admin-key", Roles: []string{RoleAdmin}},
+	}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator error = %v", err)
+	}
+	server := CreateServer(*newTestDataModel(t, `{"model": {}}`))
+	server.auth.Store(authenticator)
+	handler := server.authenticated(adminRole, server.DiagnosticsHandler)
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+	}{
+		{"no credentials", "", http.StatusUnauthorized},
+		{"invalid key", "guess", http.StatusUnauthorized},
+		{"without the admin role", "read-key", http.StatusForbidden},
+		{"admin", "admin-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/diagnostics", nil)
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ScriptInput contains everything an engine needs to evaluate a transformation script
+type ScriptInput struct {
+	Implementation string         // Source of the script
+	Self           any            // Value bound to "self"
+	Parameters     map[string]any // key: variable name, value: resolved parameter value
+	Limits         ScriptLimits   // Resource limits for the evaluation
+
+	// Console receives the output of console.log/info/warn/error, and may be nil
+	Console func(level, message string)
+
+	// Host provides model.get, model.meta, model.set and mqtt.publish. They aren't defined if it is nil.
+	Host ScriptHost
+}
+
+// defaultScriptTimeout bounds the execution time of scripts without a timeout, since they run while holding
+// the data model's lock and a runaway script would otherwise block every request
+const defaultScriptTimeout = 1 * time.Second
+
+// ScriptLimits bounds the resources a script may use. Zero values mean the engine's defaults.
+type ScriptLimits struct {
+	Timeout     time.Duration // Maximum execution time, 1 second by default
+	MemoryPages uint32        // Maximum WebAssembly memory in 64KB pages (wasm engine only)
+}
+
+// timeout returns the maximum execution time, or the default if none is set
+func (l ScriptLimits) timeout() time.Duration {
+	if l.Timeout > 0 {
+		return l.Timeout
+	}
+	return defaultScriptTimeout
+}
+
+// ScriptError is a script failure that can be located in the script's source.
+// Line and Column start at 1, and are 0 when the engine couldn't determine them.
+type ScriptError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+func (e *ScriptError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", e.Message, e.Line, e.Column)
+}
+
+// TransformEngine evaluates transformation scripts written in a particular language
+type TransformEngine interface {
+	// Check compiles a script without running it, reporting any syntax errors
+	Check(implementation string) error
+
+	// Run evaluates a script and returns its result as a JSON-compatible Go value
+	Run(input ScriptInput) (any, error)
+}
+
+// transformEngines contains all engines compiled into the binary, keyed by the name used in the "engine" field
+var transformEngines = make(map[string]TransformEngine)
+
+// registerEngine makes an engine available to transformations under the given name
+func registerEngine(name string, engine TransformEngine) {
+	transformEngines[name] = engine
+}
+
+// getEngine returns the engine with the given name, or the build's default engine if the name is empty
+func getEngine(name string) (TransformEngine, error) {
+	if name == "" {
+		name = defaultEngineName
+	}
+
+	engine, exists := transformEngines[name]
+	if !exists {
+		return nil, fmt.Errorf("transformation engine '%s' is not available in this build", name)
+	}
+
+	return engine, nil
+}
+
+// normalizeResult converts an engine's native result into plain JSON types (float64, map[string]any, etc.)
+func normalizeResult(result any) (any, error) {
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	var normalized any
+	if err := json.Unmarshal(jsonData, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return normalized, nil
+}
+
+// logToConsole forwards a console message to the input's Console, if there is one
+func (input ScriptInput) logToConsole(level, message string) {
+	if input.Console != nil {
+		input.Console(level, message)
+	}
+}
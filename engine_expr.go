@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/file"
+)
+
+// exprEngine evaluates transformations written in the expr expression language (https://expr-lang.org)
+type exprEngine struct{}
+
+func init() {
+	registerEngine("expr", exprEngine{})
+}
+
+// Check compiles the expression without type information, so unknown variables are allowed
+func (exprEngine) Check(implementation string) error {
+	if _, err := expr.Compile(implementation); err != nil {
+		return fmt.Errorf("failed to compile expression: %w", exprScriptError(err))
+	}
+
+	return nil
+}
+
+// Run evaluates the expression with "self" and the parameters as variables, and model.get(path) and
+// model.meta(path) as functions
+func (exprEngine) Run(input ScriptInput) (any, error) {
+	env := map[string]any{"self": input.Self}
+	for paramName, paramValue := range input.Parameters {
+		env[paramName] = paramValue
+	}
+
+	// Expressions can read the model, but can't have side effects
+	if input.Host != nil {
+		env["model"] = map[string]any{"get": input.Host.Get, "meta": input.Host.Meta}
+	}
+
+	program, err := expr.Compile(input.Implementation, expr.Env(env))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile expression: %w", exprScriptError(err))
+	}
+
+	output, err := expr.Run(program, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate expression: %w", exprScriptError(err))
+	}
+
+	return normalizeResult(output)
+}
+
+// exprScriptError converts an expr compilation or runtime error into a ScriptError
+func exprScriptError(err error) error {
+	scriptErr := &ScriptError{Message: err.Error()}
+
+	var fileErr *file.Error
+	if errors.As(err, &fileErr) {
+		scriptErr.Message = fileErr.Message
+		// expr counts columns from 0
+		scriptErr.Line, scriptErr.Column = fileErr.Line, fileErr.Column+1
+	}
+
+	return scriptErr
+}
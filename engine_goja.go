@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+// gojaEngine runs JavaScript transformations in goja, a pure-Go runtime that doesn't require cgo
+type gojaEngine struct{}
+
+func init() {
+	registerEngine("goja", gojaEngine{})
+}
+
+// Check compiles the script without running it
+func (gojaEngine) Check(implementation string) error {
+	_, err := compileGoja(implementation)
+	return err
+}
+
+// Run evaluates the script in a fresh runtime with "self" and the parameters bound as globals
+func (gojaEngine) Run(input ScriptInput) (any, error) {
+	vm := goja.New()
+
+	// Stop runaway scripts once the timeout elapses
+	timer := time.AfterFunc(input.Limits.timeout(), func() { vm.Interrupt("execution timed out") })
+	defer timer.Stop()
+
+	if err := vm.Set("console", newGojaConsole(vm, input)); err != nil {
+		return nil, fmt.Errorf("failed to set 'console' in global context: %s", err.Error())
+	}
+
+	if input.Host != nil {
+		setGojaHost(vm, input.Host)
+	}
+
+	if err := setGojaGlobal(vm, "self", input.Self); err != nil {
+		return nil, fmt.Errorf("failed to set 'self' in global context: %s", err.Error())
+	}
+
+	for paramName, paramValue := range input.Parameters {
+		if err := setGojaGlobal(vm, paramName, paramValue); err != nil {
+			return nil, fmt.Errorf("failed to set parameter '%s' in global context: %s",
+				paramName, err.Error())
+		}
+	}
+
+	program, err := compileGoja(input.Implementation)
+	if err != nil {
+		return nil, err
+	}
+
+	jsResult, err := vm.RunProgram(program)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute JavaScript: %w", gojaScriptError(err))
+	}
+
+	result, err := exportGojaValue(vm, jsResult)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert JavaScript result to Go object: %s", err.Error())
+	}
+
+	return result, nil
+}
+
+// compileGoja parses and compiles a script, keeping the location of any syntax errors
+func compileGoja(implementation string) (*goja.Program, error) {
+	ast, err := parser.ParseFile(nil, "transformation.js", implementation, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile JavaScript: %w", gojaScriptError(err))
+	}
+
+	program, err := goja.CompileAST(ast, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile JavaScript: %w", gojaScriptError(err))
+	}
+
+	return program, nil
+}
+
+// setGojaGlobal copies a Go value into a global variable of the runtime
+func setGojaGlobal(vm *goja.Runtime, name string, value any) error {
+	jsValue, err := toGojaValue(vm, value)
+	if err != nil {
+		return err
+	}
+
+	return vm.Set(name, jsValue)
+}
+
+// toGojaValue copies a Go value into the runtime by parsing its JSON, so scripts can't modify the model
+func toGojaValue(vm *goja.Runtime, value any) (goja.Value, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Go object: %w", err)
+	}
+
+	parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	jsValue, err := parse(goja.Undefined(), vm.ToValue(string(jsonData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JS object: %w", err)
+	}
+
+	return jsValue, nil
+}
+
+// setGojaHost defines the "model" and "mqtt" objects, whose methods call the host
+func setGojaHost(vm *goja.Runtime, host ScriptHost) {
+	// Errors are thrown into the script as exceptions
+	throw := func(err error) {
+		panic(vm.NewGoError(err))
+	}
+
+	model := vm.NewObject()
+	model.Set("get", func(call goja.FunctionCall) goja.Value {
+		value, err := host.Get(call.Argument(0).String())
+		if err != nil {
+			throw(err)
+		}
+
+		jsValue, err := toGojaValue(vm, value)
+		if err != nil {
+			throw(err)
+		}
+		return jsValue
+	})
+	model.Set("meta", func(call goja.FunctionCall) goja.Value {
+		metadata, err := host.Meta(call.Argument(0).String())
+		if err != nil {
+			throw(err)
+		}
+
+		jsValue, err := toGojaValue(vm, metadata)
+		if err != nil {
+			throw(err)
+		}
+		return jsValue
+	})
+	model.Set("set", func(call goja.FunctionCall) goja.Value {
+		value, err := exportGojaValue(vm, call.Argument(1))
+		if err != nil {
+			throw(err)
+		}
+
+		if err := host.Set(call.Argument(0).String(), value); err != nil {
+			throw(err)
+		}
+		return goja.Undefined()
+	})
+
+	mqtt := vm.NewObject()
+	mqtt.Set("publish", func(call goja.FunctionCall) goja.Value {
+		payload, err := exportGojaValue(vm, call.Argument(1))
+		if err != nil {
+			throw(err)
+		}
+
+		if err := host.Publish(call.Argument(0).String(), payload); err != nil {
+			throw(err)
+		}
+		return goja.Undefined()
+	})
+
+	vm.Set("model", model)
+	vm.Set("mqtt", mqtt)
+}
+
+// exportGojaValue converts a script result into plain JSON types, falling back to its string representation
+func exportGojaValue(vm *goja.Runtime, jsValue goja.Value) (any, error) {
+	if jsValue == nil || goja.IsUndefined(jsValue) || goja.IsNull(jsValue) {
+		return nil, nil
+	}
+
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+	jsonValue, err := stringify(goja.Undefined(), jsValue)
+	if err != nil || goja.IsUndefined(jsonValue) {
+		// Failed to convert: must not be serializable
+		return jsValue.String(), nil
+	}
+
+	var target any
+	if err := json.Unmarshal([]byte(jsonValue.String()), &target); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JavaScript value: %w", err)
+	}
+
+	return target, nil
+}
+
+// newGojaConsole creates a "console" object whose methods forward to the input's Console
+func newGojaConsole(vm *goja.Runtime, input ScriptInput) *goja.Object {
+	console := vm.NewObject()
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+
+	for _, level := range []string{"log", "info", "warn", "error"} {
+		console.Set(level, func(call goja.FunctionCall) goja.Value {
+			args := make([]string, 0, len(call.Arguments))
+			for _, arg := range call.Arguments {
+				// Objects are shown as JSON rather than "[object Object]"
+				if _, isObject := arg.(*goja.Object); isObject {
+					if _, isFunction := goja.AssertFunction(arg); !isFunction {
+						if jsonValue, err := stringify(goja.Undefined(), arg); err == nil {
+							args = append(args, jsonValue.String())
+							continue
+						}
+					}
+				}
+				args = append(args, arg.String())
+			}
+
+			input.logToConsole(level, strings.Join(args, " "))
+			return goja.Undefined()
+		})
+	}
+
+	return console
+}
+
+// gojaScriptError converts a goja parser error, compilation error or exception into a ScriptError
+func gojaScriptError(err error) error {
+	scriptErr := &ScriptError{Message: err.Error()}
+
+	var parseErrs parser.ErrorList
+	var syntaxErr *goja.CompilerSyntaxError
+	var stackErr interface{ Stack() []goja.StackFrame }
+	switch {
+	case errors.As(err, &parseErrs) && len(parseErrs) > 0:
+		scriptErr.Message = parseErrs[0].Message
+		scriptErr.Line, scriptErr.Column = parseErrs[0].Position.Line, parseErrs[0].Position.Column
+	case errors.As(err, &syntaxErr):
+		scriptErr.Message = syntaxErr.Message
+		if syntaxErr.File != nil {
+			position := syntaxErr.File.Position(syntaxErr.Offset)
+			scriptErr.Line, scriptErr.Column = position.Line, position.Column
+		}
+	case errors.As(err, &stackErr):
+		if stack := stackErr.Stack(); len(stack) > 0 {
+			position := stack[0].Position()
+			scriptErr.Line, scriptErr.Column = position.Line, position.Column
+		}
+		if exception, ok := err.(*goja.Exception); ok {
+			scriptErr.Message = exception.Value().String()
+		}
+	}
+
+	return scriptErr
+}
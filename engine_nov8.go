@@ -0,0 +1,7 @@
+//go:build nov8
+
+package main
+
+// defaultEngineName is the engine used by transformations without an "engine" field.
+// Builds without V8 fall back to the pure-Go JavaScript runtime.
+const defaultEngineName = "goja"
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeScriptHost serves model.get and model.meta from its values, and records model.set and mqtt.publish calls
+type fakeScriptHost struct {
+	values    map[string]any
+	sets      map[string]any
+	published map[string]any
+}
+
+func newFakeScriptHost(values map[string]any) *fakeScriptHost {
+	return &fakeScriptHost{values: values, sets: make(map[string]any), published: make(map[string]any)}
+}
+
+func (h *fakeScriptHost) Get(path string) (any, error) {
+	value, ok := h.values[path]
+	if !ok {
+		return nil, fmt.Errorf("path '%s' not found", path)
+	}
+	return value, nil
+}
+
+func (h *fakeScriptHost) Meta(path string) (any, error) {
+	if _, ok := h.values[path]; !ok {
+		return nil, nil
+	}
+	return map[string]any{"quality": QualityGood}, nil
+}
+
+func (h *fakeScriptHost) Set(path string, value any) error {
+	h.sets[path] = value
+	return nil
+}
+
+func (h *fakeScriptHost) Publish(topic string, payload any) error {
+	h.published[topic] = payload
+	return nil
+}
+
+type engineTest struct {
+	name           string
+	implementation string
+	self           any
+	parameters     map[string]any
+	want           string // JSON of the result, if the script succeeds
+	wantSets       string // JSON of the values written with model.set
+	wantPublished  string // JSON of the payloads published with mqtt.publish
+	wantErr        bool
+}
+
+// runEngineTests runs the scripts with the engine, if it is available in this build
+func runEngineTests(t *testing.T, engineName string, tests []engineTest) {
+	engine, err := getEngine(engineName)
+	if err != nil {
+		return
+	}
+
+	for _, tt := range tests {
+		t.Run(engineName+" "+tt.name, func(t *testing.T) {
+			host := newFakeScriptHost(map[string]any{"line/speed": 41.0})
+			result, err := engine.Run(ScriptInput{
+				Implementation: tt.implementation,
+				Self:           tt.self,
+				Parameters:     tt.parameters,
+				Host:           host,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Run() = %v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			for _, check := range []struct {
+				what string
+				got  any
+				want string
+			}{
+				{"result", result, tt.want},
+				{"model.set calls", host.sets, withDefaultJson(tt.wantSets, `{}`)},
+				{"mqtt.publish calls", host.published, withDefaultJson(tt.wantPublished, `{}`)},
+			} {
+				if got, _ := json.Marshal(check.got); string(got) != check.want {
+					t.Errorf("%s = %s, want %s", check.what, got, check.want)
+				}
+			}
+		})
+	}
+}
+
+// withDefaultJson returns the JSON, or the default if it is empty
+func withDefaultJson(json, defaultJson string) string {
+	if json == "" {
+		return defaultJson
+	}
+	return json
+}
+
+func TestJavaScriptEngines(t *testing.T) {
+	tests := []engineTest{
+		{name: "self", implementation: "self * 2", self: 21.0, want: `42`},
+		{name: "self object", implementation: "self.a + self.b", self: map[string]any{"a": 1.0, "b": 2.0}, want: `3`},
+		{name: "null self", implementation: "self === null", want: `true`},
+		{name: "parameters", implementation: "x + y", parameters: map[string]any{"x": 1.0, "y": 2.0}, want: `3`},
+		{name: "object result", implementation: "({sum: self.a + self.b, list: [1, 'two', null]})",
+			self: map[string]any{"a": 1.0, "b": 2.0}, want: `{"list":[1,"two",null],"sum":3}`},
+		{name: "statements", implementation: "let total = 0;\nfor (const v of self) total += v;\ntotal", self: []any{1.0, 2.0, 3.0}, want: `6`},
+		{name: "model.get", implementation: "model.get('line/speed') + 1", want: `42`},
+		{name: "model.meta", implementation: "model.meta('line/speed').quality", want: `"good"`},
+		{name: "model.set", implementation: "model.set('line/target', self * 2); self", self: 5.0,
+			want: `5`, wantSets: `{"line/target":10}`},
+		{name: "mqtt.publish", implementation: "mqtt.publish('line/alarm', {level: self}), 0", self: 3.0,
+			want: `0`, wantPublished: `{"line/alarm":{"level":3}}`},
+		{name: "host error", implementation: "model.get('line/missing')", wantErr: true},
+		{name: "thrown error", implementation: "throw new Error('boom')", wantErr: true},
+		{name: "reference error", implementation: "notDefined + 1", wantErr: true},
+	}
+
+	for _, engineName := range []string{"goja", "v8"} {
+		runEngineTests(t, engineName, tests)
+	}
+}
+
+func TestExprEngine(t *testing.T) {
+	runEngineTests(t, "expr", []engineTest{
+		{name: "self", implementation: "self * 2", self: 21.0, want: `42`},
+		{name: "self object", implementation: "self.a + self.b", self: map[string]any{"a": 1.0, "b": 2.0}, want: `3`},
+		{name: "null self", implementation: "self == nil", want: `true`},
+		{name: "parameters", implementation: "x + y", parameters: map[string]any{"x": 1.0, "y": 2.0}, want: `3`},
+		{name: "object result", implementation: "{sum: self.a + self.b, list: [1, 'two', nil]}",
+			self: map[string]any{"a": 1.0, "b": 2.0}, want: `{"list":[1,"two",null],"sum":3}`},
+		{name: "model.get", implementation: "model.get('line/speed') + 1", want: `42`},
+		{name: "model.set isn't supported", implementation: "model.set('line/target', 1)", wantErr: true},
+		{name: "host error", implementation: "model.get('line/missing')", wantErr: true},
+		{name: "unknown variable", implementation: "notDefined + 1", wantErr: true},
+	})
+}
+
+func TestEngineCheck(t *testing.T) {
+	tests := []struct {
+		engine         string
+		implementation string
+		wantErr        bool
+		wantLine       int // Line of the syntax error, if the engine reports it
+	}{
+		{"goja", "self * 2", false, 0},
+		{"goja", "let a = 1;\na +", true, 2},
+		{"goja", "self +* 2", true, 1},
+		{"v8", "self * 2", false, 0},
+		{"v8", "let a = 1;\na +", true, 2},
+		{"expr", "self * 2", false, 0},
+		{"expr", "notDefined + 1", false, 0}, // Variables are only known when the expression runs
+		{"expr", "self *\n* 2", true, 2},
+	}
+
+	for _, tt := range tests {
+		engine, err := getEngine(tt.engine)
+		if err != nil {
+			continue // Not in this build
+		}
+
+		err = engine.Check(tt.implementation)
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("%s Check(%q) error = %v", tt.engine, tt.implementation, err)
+			}
+			continue
+		}
+
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) {
+			t.Errorf("%s Check(%q) error = %v, want a script error", tt.engine, tt.implementation, err)
+			continue
+		}
+		if scriptErr.Line != tt.wantLine {
+			t.Errorf("%s Check(%q) error at line %d, want line %d: %v", tt.engine, tt.implementation, scriptErr.Line, tt.wantLine, err)
+		}
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits ScriptLimits
+		want   time.Duration
+	}{
+		{"default", ScriptLimits{}, defaultScriptTimeout},
+		{"configured", ScriptLimits{Timeout: 50 * time.Millisecond}, 50 * time.Millisecond},
+	}
+
+	// JavaScript engines not in this build are skipped
+	for _, engineName := range []string{"goja", "v8"} {
+		engine, err := getEngine(engineName)
+		if err != nil {
+			continue
+		}
+
+		for _, tt := range tests {
+			t.Run(engineName+" "+tt.name, func(t *testing.T) {
+				if got := tt.limits.timeout(); got != tt.want {
+					t.Fatalf("timeout() = %s, want %s", got, tt.want)
+				}
+
+				start := time.Now()
+				_, err := engine.Run(ScriptInput{Implementation: "while (true) {}", Limits: tt.limits})
+				elapsed := time.Since(start)
+				if err == nil {
+					t.Fatal("endless script returned without an error")
+				}
+				if elapsed < tt.want || elapsed > tt.want+time.Second {
+					t.Errorf("endless script stopped after %s, want %s", elapsed, tt.want)
+				}
+			})
+		}
+	}
+}
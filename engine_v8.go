@@ -0,0 +1,248 @@
+//go:build !nov8
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v8 "rogchap.com/v8go"
+)
+
+// defaultEngineName is the engine used by transformations without an "engine" field
+const defaultEngineName = "v8"
+
+// v8Engine runs JavaScript transformations in V8. It requires cgo and can be excluded with the nov8 build tag.
+type v8Engine struct{}
+
+func init() {
+	registerEngine("v8", v8Engine{})
+}
+
+// Check compiles the script in a fresh isolate
+func (v8Engine) Check(implementation string) error {
+	iso := v8.NewIsolate()
+	defer iso.Dispose()
+
+	if _, err := iso.CompileUnboundScript(implementation, "transformation.js", v8.CompileOptions{}); err != nil {
+		return fmt.Errorf("failed to compile JavaScript: %w", v8ScriptError(err))
+	}
+
+	return nil
+}
+
+// Run evaluates the script in a fresh isolate with "self" and the parameters bound as globals
+func (v8Engine) Run(input ScriptInput) (any, error) {
+	// Create the V8 environment
+	iso := v8.NewIsolate()
+	defer iso.Dispose()
+
+	// Create the global object template
+	global := v8.NewObjectTemplate(iso)
+
+	// Create the context with the global template
+	ctx := v8.NewContext(iso, global)
+	defer ctx.Close()
+
+	// Replace V8's built-in console with one forwarding to the input's Console
+	console, err := newV8Console(iso, input).NewInstance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create 'console': %s", err.Error())
+	}
+	if err := ctx.Global().Set("console", console); err != nil {
+		return nil, fmt.Errorf("failed to set 'console' in global context: %s", err.Error())
+	}
+
+	// Bind the model and mqtt objects if there is a host
+	if input.Host != nil {
+		if err := setV8Host(iso, ctx, input.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	// Convert Go data to JavaScript object
+	jsInput, err := ConvertGoToJavaScript(ctx, input.Self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert data to JavaScript object: %s", err.Error())
+	}
+
+	// Set the "self" variable in the global context
+	err = ctx.Global().Set("self", jsInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set 'self' in global context: %s", err.Error())
+	}
+
+	// Set any parameters in the global context
+	for paramName, paramValue := range input.Parameters {
+		// Convert parameter value to JavaScript
+		jsParamValue, err := ConvertGoToJavaScript(ctx, paramValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert parameter '%s' to JavaScript: %s",
+				paramName, err.Error())
+		}
+
+		// Set the parameter in the global context
+		err = ctx.Global().Set(paramName, jsParamValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set parameter '%s' in global context: %s",
+				paramName, err.Error())
+		}
+	}
+
+	// Stop runaway scripts once the timeout elapses
+	timer := time.AfterFunc(input.Limits.timeout(), iso.TerminateExecution)
+	defer timer.Stop()
+
+	// Run the transformation script
+	jsResult, err := ctx.RunScript(input.Implementation, "transformation.js")
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute JavaScript: %w", v8ScriptError(err))
+	}
+
+	result, err := ConvertJavaScriptToGo(ctx, jsResult)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert JavaScript result to Go object: %s", err.Error())
+	}
+
+	return result, nil
+}
+
+// newV8Console creates the template for a "console" object whose methods forward to the input's Console
+func newV8Console(iso *v8.Isolate, input ScriptInput) *v8.ObjectTemplate {
+	console := v8.NewObjectTemplate(iso)
+
+	for _, level := range []string{"log", "info", "warn", "error"} {
+		console.Set(level, v8.NewFunctionTemplate(iso, func(info *v8.FunctionCallbackInfo) *v8.Value {
+			args := make([]string, 0, len(info.Args()))
+			for _, arg := range info.Args() {
+				// Objects are shown as JSON rather than "[object Object]"
+				if arg.IsObject() && !arg.IsFunction() {
+					if jsonValue, err := v8.JSONStringify(info.Context(), arg); err == nil {
+						args = append(args, jsonValue)
+						continue
+					}
+				}
+				args = append(args, arg.String())
+			}
+
+			input.logToConsole(level, strings.Join(args, " "))
+			return nil
+		}))
+	}
+
+	return console
+}
+
+// setV8Host defines the "model" and "mqtt" objects, whose methods call the host
+func setV8Host(iso *v8.Isolate, ctx *v8.Context, host ScriptHost) error {
+	model := v8.NewObjectTemplate(iso)
+	model.Set("get", v8.NewFunctionTemplate(iso, func(info *v8.FunctionCallbackInfo) *v8.Value {
+		args := info.Args()
+		if len(args) < 1 {
+			return throwV8Error(iso, "model.get(path) expects a path")
+		}
+
+		value, err := host.Get(args[0].String())
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+
+		jsValue, err := ConvertGoToJavaScript(info.Context(), value)
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+		return jsValue
+	}))
+	model.Set("meta", v8.NewFunctionTemplate(iso, func(info *v8.FunctionCallbackInfo) *v8.Value {
+		args := info.Args()
+		if len(args) < 1 {
+			return throwV8Error(iso, "model.meta(path) expects a path")
+		}
+
+		metadata, err := host.Meta(args[0].String())
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+
+		jsValue, err := ConvertGoToJavaScript(info.Context(), metadata)
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+		return jsValue
+	}))
+	model.Set("set", v8.NewFunctionTemplate(iso, func(info *v8.FunctionCallbackInfo) *v8.Value {
+		args := info.Args()
+		if len(args) < 2 {
+			return throwV8Error(iso, "model.set(path, value) expects a path and a value")
+		}
+
+		value, err := ConvertJavaScriptToGo(info.Context(), args[1])
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+
+		if err := host.Set(args[0].String(), value); err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+		return nil
+	}))
+
+	mqtt := v8.NewObjectTemplate(iso)
+	mqtt.Set("publish", v8.NewFunctionTemplate(iso, func(info *v8.FunctionCallbackInfo) *v8.Value {
+		args := info.Args()
+		if len(args) < 2 {
+			return throwV8Error(iso, "mqtt.publish(topic, payload) expects a topic and a payload")
+		}
+
+		payload, err := ConvertJavaScriptToGo(info.Context(), args[1])
+		if err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+
+		if err := host.Publish(args[0].String(), payload); err != nil {
+			return throwV8Error(iso, err.Error())
+		}
+		return nil
+	}))
+
+	for name, template := range map[string]*v8.ObjectTemplate{"model": model, "mqtt": mqtt} {
+		instance, err := template.NewInstance(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create '%s': %s", name, err.Error())
+		}
+		if err := ctx.Global().Set(name, instance); err != nil {
+			return fmt.Errorf("failed to set '%s' in global context: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// throwV8Error throws a JavaScript exception with the message from a function callback
+func throwV8Error(iso *v8.Isolate, message string) *v8.Value {
+	value, err := v8.NewValue(iso, message)
+	if err != nil {
+		return nil
+	}
+	return iso.ThrowException(value)
+}
+
+// v8ScriptError converts a V8 exception into a ScriptError, using its "file:line:column" location
+func v8ScriptError(err error) error {
+	scriptErr := &ScriptError{Message: err.Error()}
+
+	var jsErr *v8.JSError
+	if errors.As(err, &jsErr) {
+		scriptErr.Message = jsErr.Message
+		location := strings.Split(jsErr.Location, ":")
+		if len(location) >= 3 {
+			scriptErr.Line, _ = strconv.Atoi(location[len(location)-2])
+			scriptErr.Column, _ = strconv.Atoi(location[len(location)-1])
+		}
+	}
+
+	return scriptErr
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const defaultWasmMemoryPages = 256 // 16MB, each page is 64KB
+
+// wasmEngine runs transformations compiled to WebAssembly using wazero.
+//
+// The "implementation" field is the path to a .wasm file. The module must export its memory and:
+//
+//	alloc(size i32) -> i32             allocates size bytes for the input and returns a pointer to them
+//	transform(ptr i32, len i32) -> i64 transforms the input, returning (resultPtr << 32 | resultLen)
+//
+// The input is the JSON object {"self": ..., "parameters": {...}} and the result must be JSON.
+// Modules run sandboxed: WASI is available without filesystem, environment or network access,
+// and execution is bounded by the transformation's timeout and memory limits. Lines written to
+// stdout and stderr are forwarded to the console as "log" and "error" messages.
+type wasmEngine struct {
+	cache wazero.CompilationCache
+
+	mu      sync.Mutex
+	modules map[string]wasmModuleFile // key: file path
+}
+
+// wasmModuleFile is a module's bytes along with the modification time they were read at
+type wasmModuleFile struct {
+	modTime time.Time
+	binary  []byte
+}
+
+func init() {
+	registerEngine("wasm", &wasmEngine{
+		cache:   wazero.NewCompilationCache(),
+		modules: make(map[string]wasmModuleFile),
+	})
+}
+
+// readModule reads a module file, reusing the previous contents if it hasn't changed
+func (e *wasmEngine) readModule(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WebAssembly module: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if module, ok := e.modules[path]; ok && module.modTime.Equal(info.ModTime()) {
+		return module.binary, nil
+	}
+
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WebAssembly module: %w", err)
+	}
+	e.modules[path] = wasmModuleFile{modTime: info.ModTime(), binary: binary}
+
+	return binary, nil
+}
+
+// newRuntime creates a runtime sharing the engine's compilation cache and enforcing the given limits
+func (e *wasmEngine) newRuntime(ctx context.Context, limits ScriptLimits) wazero.Runtime {
+	memoryPages := limits.MemoryPages
+	if memoryPages == 0 {
+		memoryPages = defaultWasmMemoryPages
+	}
+
+	config := wazero.NewRuntimeConfig().
+		WithCompilationCache(e.cache).
+		WithMemoryLimitPages(memoryPages).
+		WithCloseOnContextDone(true)
+
+	return wazero.NewRuntimeWithConfig(ctx, config)
+}
+
+// Check compiles the module and verifies that it has the expected exports
+func (e *wasmEngine) Check(implementation string) error {
+	binary, err := e.readModule(implementation)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	runtime := e.newRuntime(ctx, ScriptLimits{})
+	defer runtime.Close(ctx)
+
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return fmt.Errorf("failed to compile WebAssembly module: %s", err.Error())
+	}
+
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{"alloc", "transform"} {
+		if _, ok := exports[name]; !ok {
+			return fmt.Errorf("WebAssembly module doesn't export a '%s' function", name)
+		}
+	}
+	if len(compiled.ExportedMemories()) == 0 {
+		return fmt.Errorf("WebAssembly module doesn't export its memory")
+	}
+
+	return nil
+}
+
+// Run instantiates the module in a fresh runtime and calls its transform function
+func (e *wasmEngine) Run(input ScriptInput) (any, error) {
+	binary, err := e.readModule(input.Implementation)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := e.newRuntime(context.Background(), input.Limits)
+	defer runtime.Close(context.Background())
+
+	// Compilation isn't part of the time limit since its result is cached between runs
+	compiled, err := runtime.CompileModule(context.Background(), binary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile WebAssembly module: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), input.Limits.timeout())
+	defer cancel()
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	stdout := &wasmConsoleWriter{input: input, level: "log"}
+	stderr := &wasmConsoleWriter{input: input, level: "error"}
+	defer stdout.flush()
+	defer stderr.flush()
+
+	// Reactor modules (e.g. built by TinyGo or Rust) are initialized by "_initialize" rather than "_start"
+	module, err := runtime.InstantiateModule(ctx, compiled,
+		wazero.NewModuleConfig().
+			WithStartFunctions("_initialize").
+			WithStdout(stdout).
+			WithStderr(stderr))
+	if err != nil {
+		return nil, wasmError("failed to instantiate WebAssembly module", ctx, err)
+	}
+
+	alloc := module.ExportedFunction("alloc")
+	transform := module.ExportedFunction("transform")
+	if alloc == nil || transform == nil {
+		return nil, fmt.Errorf("WebAssembly module must export 'alloc' and 'transform' functions")
+	}
+
+	inputJSON, err := json.Marshal(map[string]any{
+		"self":       input.Self,
+		"parameters": input.Parameters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal WebAssembly input: %w", err)
+	}
+
+	// Copy the input into the module's memory
+	allocResult, err := alloc.Call(ctx, uint64(len(inputJSON)))
+	if err != nil {
+		return nil, wasmError("failed to allocate WebAssembly memory", ctx, err)
+	}
+	inputPtr := uint32(allocResult[0])
+	if !module.Memory().Write(inputPtr, inputJSON) {
+		return nil, fmt.Errorf("WebAssembly input pointer %d is out of range", inputPtr)
+	}
+
+	transformResult, err := transform.Call(ctx, uint64(inputPtr), uint64(len(inputJSON)))
+	if err != nil {
+		return nil, wasmError("failed to execute WebAssembly transform", ctx, err)
+	}
+
+	return readWasmResult(module.Memory(), transformResult[0])
+}
+
+// readWasmResult unmarshals the JSON result referred to by a packed (pointer << 32 | length) value
+func readWasmResult(memory api.Memory, packed uint64) (any, error) {
+	resultPtr, resultLen := uint32(packed>>32), uint32(packed)
+
+	resultJSON, ok := memory.Read(resultPtr, resultLen)
+	if !ok {
+		return nil, fmt.Errorf("WebAssembly result (pointer %d, length %d) is out of range", resultPtr, resultLen)
+	}
+
+	var result any
+	if err := json.Unmarshal(resultJSON, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal WebAssembly result: %w", err)
+	}
+
+	return result, nil
+}
+
+// wasmConsoleWriter forwards each line a module writes to stdout or stderr to the input's Console
+type wasmConsoleWriter struct {
+	input  ScriptInput
+	level  string
+	buffer []byte
+}
+
+func (w *wasmConsoleWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		end := bytes.IndexByte(w.buffer, '\n')
+		if end < 0 {
+			break
+		}
+		w.input.logToConsole(w.level, string(w.buffer[:end]))
+		w.buffer = w.buffer[end+1:]
+	}
+	return len(p), nil
+}
+
+// flush forwards any output that wasn't terminated by a newline
+func (w *wasmConsoleWriter) flush() {
+	if len(w.buffer) > 0 {
+		w.input.logToConsole(w.level, string(w.buffer))
+		w.buffer = nil
+	}
+}
+
+// wasmError describes a failed call, reporting a timeout if the context deadline was exceeded
+func wasmError(message string, ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: execution timed out", message)
+	}
+	return fmt.Errorf("%s: %s", message, err.Error())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWasmEngineCheck(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	os.WriteFile(invalid, []byte("not a module"), 0644)
+	noExports := filepath.Join(dir, "empty.wasm")
+	os.WriteFile(noExports, []byte("\x00asm\x01\x00\x00\x00"), 0644)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"valid module", "testdata/echo.wasm", false},
+		{"missing file", filepath.Join(dir, "missing.wasm"), true},
+		{"invalid module", invalid, true},
+		{"module without exports", noExports, true},
+	}
+
+	engine, err := getEngine("wasm")
+	if err != nil {
+		t.Fatalf("getEngine error = %v", err)
+	}
+	for _, tt := range tests {
+		if err := engine.Check(tt.path); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Check() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWasmEngineRun(t *testing.T) {
+	engine, err := getEngine("wasm")
+	if err != nil {
+		t.Fatalf("getEngine error = %v", err)
+	}
+
+	result, err := engine.Run(ScriptInput{
+		Implementation: "testdata/echo.wasm",
+		Self:           map[string]any{"speed": 3.0},
+		Parameters:     map[string]any{"factor": 2.0},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// The module returns its input
+	got, _ := json.Marshal(result)
+	if want := `{"parameters":{"factor":2},"self":{"speed":3}}`; string(got) != want {
+		t.Errorf("Run() = %s, want %s", got, want)
+	}
+
+	if _, err := engine.Run(ScriptInput{Implementation: "testdata/missing.wasm"}); err == nil {
+		t.Error("Run() of a missing module succeeded, want an error")
+	}
+}
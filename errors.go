@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorKind is a category of errors, determining the status code and "code" of error responses.
+// Errors of a kind match it with errors.Is, however much context they are wrapped in.
+type ErrorKind struct {
+	Code   string // Machine-readable identifier of the kind
+	Status int    // HTTP status code of the kind
+}
+
+func (k *ErrorKind) Error() string {
+	return k.Code
+}
+
+// Kinds of errors returned to clients
+var (
+	ErrBadRequest           = &ErrorKind{Code: "bad_request", Status: http.StatusBadRequest}
+	ErrUnauthorized         = &ErrorKind{Code: "unauthorized", Status: http.StatusUnauthorized}
+	ErrForbidden            = &ErrorKind{Code: "forbidden", Status: http.StatusForbidden}
+	ErrNotFound             = &ErrorKind{Code: "not_found", Status: http.StatusNotFound}
+	ErrMethodNotAllowed     = &ErrorKind{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed}
+	ErrPreconditionFailed   = &ErrorKind{Code: "precondition_failed", Status: http.StatusPreconditionFailed}
+	ErrRequestTooLarge      = &ErrorKind{Code: "request_too_large", Status: http.StatusRequestEntityTooLarge}
+	ErrUnsupportedMediaType = &ErrorKind{Code: "unsupported_media_type", Status: http.StatusUnsupportedMediaType}
+	ErrValueRejected        = &ErrorKind{Code: "value_rejected", Status: http.StatusUnprocessableEntity}
+	ErrTooManyRequests      = &ErrorKind{Code: "too_many_requests", Status: http.StatusTooManyRequests}
+	ErrTransformationFailed = &ErrorKind{Code: "transformation_failed", Status: http.StatusInternalServerError}
+	ErrInternal             = &ErrorKind{Code: "internal_error", Status: http.StatusInternalServerError}
+)
+
+// kindError is an error of a particular kind. Its message is that of the underlying error.
+type kindError struct {
+	kind *ErrorKind
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// newError creates an error of the kind, formatting the message like fmt.Errorf
+func newError(kind *ErrorKind, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// wrapError marks an error as being of the kind, keeping its message
+func wrapError(kind *ErrorKind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// retryError is an error of a request that may succeed when it is retried after a delay
+type retryError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// retryAfter marks an error as going away after the delay, which error responses pass on in a Retry-After header
+func retryAfter(err error, delay time.Duration) error {
+	return &retryError{err: err, delay: delay}
+}
+
+// errorKindOf returns the kind of an error. When wrapped errors have different kinds, the outermost one applies.
+func errorKindOf(err error) *ErrorKind {
+	var kind *ErrorKind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return ErrInternal
+}
+
+// Problem is an RFC 7807 problem details object describing a failed request
+type Problem struct {
+	Type   string `json:"type"`             // URI identifying the problem type
+	Title  string `json:"title"`            // Summary of the problem type
+	Status int    `json:"status"`           // HTTP status code
+	Code   string `json:"code"`             // Machine-readable kind of the error
+	Detail string `json:"detail"`           // Explanation of this occurrence of the problem
+	Path   string `json:"path"`             // Path of the request
+	Line   int    `json:"line,omitempty"`   // Line of the script error causing the problem, if any
+	Column int    `json:"column,omitempty"` // Column of the script error causing the problem, if any
+}
+
+// newProblem describes an error that occurred while handling a request
+func newProblem(r *http.Request, err error) Problem {
+	kind := errorKindOf(err)
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(kind.Status),
+		Status: kind.Status,
+		Code:   kind.Code,
+		Detail: err.Error(),
+		Path:   r.URL.Path,
+	}
+
+	var scriptErr *ScriptError
+	if errors.As(err, &scriptErr) {
+		problem.Line, problem.Column = scriptErr.Line, scriptErr.Column
+	}
+
+	return problem
+}
+
+// sendErrorResponse sends an application/problem+json response with the status code of the error's kind
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	problem := newProblem(r, err)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	var retryErr *retryError
+	if errors.As(err, &retryErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryErr.delay.Seconds())))))
+	}
+	w.WriteHeader(problem.Status)
+
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
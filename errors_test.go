@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want *ErrorKind
+	}{
+		{"new error", newError(ErrNotFound, "path '%s' not found", "a"), ErrNotFound},
+		{"wrapped with context", fmt.Errorf("reading: %w", newError(ErrBadRequest, "bad")), ErrBadRequest},
+		{"outermost kind applies", wrapError(ErrTransformationFailed, newError(ErrNotFound, "missing")), ErrTransformationFailed},
+		{"retry keeps the kind", retryAfter(newError(ErrTooManyRequests, "slow down"), time.Second), ErrTooManyRequests},
+		{"plain error", errors.New("disk full"), ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorKindOf(tt.err); got != tt.want {
+				t.Errorf("errorKindOf() = %s, want %s", got.Code, tt.want.Code)
+			}
+			if tt.want != ErrInternal && !errors.Is(tt.err, tt.want) {
+				t.Errorf("errors.Is(err, %s) = false", tt.want.Code)
+			}
+		})
+	}
+}
+
+func TestSendErrorResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       string
+		wantRetryAfter string
+		wantLine       int
+	}{
+		{"not found", newError(ErrNotFound, "path 'a' not found"), http.StatusNotFound, "not_found", "", 0},
+		{"internal", errors.New("disk full"), http.StatusInternalServerError, "internal_error", "", 0},
+		{"retry after rounds up", retryAfter(newError(ErrTooManyRequests, "slow down"), 1500*time.Millisecond),
+			http.StatusTooManyRequests, "too_many_requests", "2", 0},
+		{"script error location", wrapError(ErrTransformationFailed, &ScriptError{Message: "boom", Line: 3, Column: 7}),
+			http.StatusInternalServerError, "transformation_failed", "", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sendErrorResponse(w, httptest.NewRequest(http.MethodGet, "/model/a", nil), tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", contentType)
+			}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, tt.wantRetryAfter)
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("invalid problem JSON: %v", err)
+			}
+			if problem.Code != tt.wantCode || problem.Status != tt.wantStatus || problem.Path != "/model/a" {
+				t.Errorf("problem = %+v, want code %s and status %d", problem, tt.wantCode, tt.wantStatus)
+			}
+			if problem.Detail != tt.err.Error() || problem.Line != tt.wantLine {
+				t.Errorf("problem = %+v, want detail %q and line %d", problem, tt.err.Error(), tt.wantLine)
+			}
+		})
+	}
+}
@@ -5,9 +5,22 @@ go 1.23.0
 toolchain go1.23.3
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.5.0 // indirect
+	github.com/dop251/goja v0.0.0-20241024094426-79f3a7efcdbd
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/expr-lang/expr v1.17.8
+	github.com/golang-jwt/jwt/v5 v5.3.1
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/tetratelabs/wazero v1.9.0
+	rogchap.com/v8go v0.9.0
+)
+
+require (
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/net v0.37.0 // indirect
-	golang.org/x/sync v0.7.0 // indirect
-	rogchap.com/v8go v0.9.0 // indirect
+	golang.org/x/sync v0.12.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
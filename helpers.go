@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"strings"
 )
@@ -55,6 +54,57 @@ func DeepCopyMap(original map[string]any) map[string]any {
 	return copy
 }
 
+// DeepCopyValue creates a deep copy of a JSON value
+func DeepCopyValue(original any) any {
+	switch val := original.(type) {
+	case map[string]any:
+		return DeepCopyMap(val)
+	case []any:
+		copySlice := make([]any, len(val))
+		for i, item := range val {
+			copySlice[i] = DeepCopyValue(item)
+		}
+		return copySlice
+	default:
+		return original
+	}
+}
+
+// WalkLeaves calls visit with the path and value of each leaf in the value at the path, which are the values that
+// aren't objects. The value itself is the only leaf if it isn't an object.
+func WalkLeaves(path string, value any, visit func(path string, value any)) {
+	valueMap, ok := value.(map[string]any)
+	if !ok {
+		visit(path, value)
+		return
+	}
+
+	for key, child := range valueMap {
+		childPath := key
+		if path != "" {
+			childPath = path + "/" + key
+		}
+		WalkLeaves(childPath, child, visit)
+	}
+}
+
+// LookupPath indexes into nested maps, reporting whether the whole path exists
+func LookupPath(data any, pathTokens []string) (any, bool) {
+	for _, token := range pathTokens {
+		currentMap, ok := data.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		data, ok = currentMap[token]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
 // GetMapData gets data directly from the model without applying transformations
 func GetMapData(modelMap *map[string]any, pathTokens []string) (any, error) {
 	// Start with the entire model
@@ -71,7 +121,7 @@ func GetMapData(modelMap *map[string]any, pathTokens []string) (any, error) {
 		// Try to get the next element
 		nextElement, exists := currentMap[token]
 		if !exists {
-			return nil, fmt.Errorf("path element '%s' not found", token)
+			return nil, newError(ErrNotFound, "path element '%s' not found", token)
 		}
 
 		// Update result to the next element
@@ -88,7 +138,7 @@ func SetMapData(modelMap *map[string]any, pathTokens []string, value any) error
 		// Check if value is a map before assigning
 		newModelMap, ok := value.(map[string]any)
 		if !ok {
-			return fmt.Errorf("expected JSON object for root model update, got %T", value)
+			return newError(ErrBadRequest, "expected JSON object for root model update, got %T", value)
 		}
 
 		// Update the pointer to point to the new map
@@ -138,3 +188,19 @@ func SetMapData(modelMap *map[string]any, pathTokens []string, value any) error
 
 	return nil
 }
+
+// DeleteMapData removes the value the pathTokens point to, if it exists
+func DeleteMapData(modelMap *map[string]any, pathTokens []string) {
+	if len(pathTokens) == 0 {
+		return
+	}
+
+	parent, err := GetMapData(modelMap, pathTokens[:len(pathTokens)-1])
+	if err != nil {
+		return
+	}
+
+	if parentMap, ok := parent.(map[string]any); ok {
+		delete(parentMap, pathTokens[len(pathTokens)-1])
+	}
+}
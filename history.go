@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the history configuration
+const (
+	defaultHistoryMaxSamples      = 1000
+	defaultHistorySegmentDuration = time.Hour
+	defaultHistoryRetention       = 7 * 24 * time.Hour
+)
+
+// HistoryConfig configures which values keep a history, and whether it is also stored on disk
+type HistoryConfig struct {
+	Rules           []HistoryRule `json:"rules"`
+	Directory       string        `json:"directory,omitempty"`       // Directory of the on-disk segments, which are only written if set
+	SegmentDuration string        `json:"segmentDuration,omitempty"` // Time span of each segment file, "1h" by default
+	Retention       string        `json:"retention,omitempty"`       // How long segments are kept, "168h" by default
+}
+
+// HistoryRule keeps the history of the values at paths matching its globs
+type HistoryRule struct {
+	Paths      []string `json:"paths"`                // Globs of model paths, e.g. "sensors/**"
+	MaxSamples int      `json:"maxSamples,omitempty"` // Number of samples of each path kept in memory, 1000 by default
+}
+
+// HistorySample is a value a path had from a point in time
+type HistorySample struct {
+	Time  time.Time `json:"time"`
+	Value any       `json:"value"`
+}
+
+// historySegmentSample is a line of an on-disk segment
+type historySegmentSample struct {
+	Path  string    `json:"path"`
+	Time  time.Time `json:"time"`
+	Value any       `json:"value"`
+}
+
+// sampleRing keeps the latest samples of a path, overwriting the oldest when it is full
+type sampleRing struct {
+	samples []HistorySample
+	start   int // Index of the oldest sample once the ring is full
+	size    int
+}
+
+func (r *sampleRing) add(sample HistorySample) {
+	if len(r.samples) < r.size {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.start] = sample
+	r.start = (r.start + 1) % r.size
+}
+
+// all returns the samples, oldest first
+func (r *sampleRing) all() []HistorySample {
+	return append(append([]HistorySample{}, r.samples[r.start:]...), r.samples[:r.start]...)
+}
+
+// historyStore records the values written to paths with a history. It is shared by the copies of a data model.
+type historyStore struct {
+	mu              sync.Mutex
+	rules           []HistoryRule
+	rings           map[string]*sampleRing // key: model path
+	directory       string
+	segmentDuration time.Duration
+	retention       time.Duration
+	segment         *os.File
+	segmentStart    time.Time
+}
+
+func newHistoryStore() *historyStore {
+	return &historyStore{rings: make(map[string]*sampleRing)}
+}
+
+// parseHistoryConfig checks the configuration, returning its segment duration and retention
+func parseHistoryConfig(config *HistoryConfig) (time.Duration, time.Duration, error) {
+	segmentDuration, retention := defaultHistorySegmentDuration, defaultHistoryRetention
+	if config == nil {
+		return segmentDuration, retention, nil
+	}
+
+	for i, rule := range config.Rules {
+		if len(rule.Paths) == 0 {
+			return 0, 0, newError(ErrBadRequest, "invalid history rule %d: 'paths' is required", i)
+		}
+		if rule.MaxSamples < 0 {
+			return 0, 0, newError(ErrBadRequest, "invalid history rule %d: 'maxSamples' can't be negative", i)
+		}
+	}
+
+	var err error
+	if config.SegmentDuration != "" {
+		if segmentDuration, err = time.ParseDuration(config.SegmentDuration); err != nil || segmentDuration <= 0 {
+			return 0, 0, newError(ErrBadRequest, "invalid history config: 'segmentDuration' must be a positive duration")
+		}
+	}
+	if config.Retention != "" {
+		if retention, err = time.ParseDuration(config.Retention); err != nil || retention <= 0 {
+			return 0, 0, newError(ErrBadRequest, "invalid history config: 'retention' must be a positive duration")
+		}
+	}
+
+	return segmentDuration, retention, nil
+}
+
+// configure switches to the configuration, keeping the samples of the paths that still have a history
+func (h *historyStore) configure(config *HistoryConfig) error {
+	segmentDuration, retention, err := parseHistoryConfig(config)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closeSegment()
+	h.rules, h.directory = nil, ""
+	h.segmentDuration, h.retention = segmentDuration, retention
+	if config != nil {
+		h.rules, h.directory = config.Rules, config.Directory
+	}
+
+	for path, ring := range h.rings {
+		if size := h.maxSamples(path); size == 0 {
+			delete(h.rings, path)
+		} else if size != ring.size {
+			h.rings[path] = &sampleRing{size: size}
+			for _, sample := range ring.all() {
+				h.rings[path].add(sample)
+			}
+		}
+	}
+
+	if h.directory != "" {
+		if err := os.MkdirAll(h.directory, 0755); err != nil {
+			return fmt.Errorf("error creating history directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// maxSamples returns the number of samples kept in memory for the path, or 0 if it has no history.
+// If several rules match, the largest number applies.
+func (h *historyStore) maxSamples(path string) int {
+	size := 0
+	for _, rule := range h.rules {
+		for _, pattern := range rule.Paths {
+			if matchPathGlob(pattern, path) {
+				if rule.MaxSamples == 0 {
+					size = max(size, defaultHistoryMaxSamples)
+				} else {
+					size = max(size, rule.MaxSamples)
+				}
+			}
+		}
+	}
+	return size
+}
+
+// record adds a sample for each leaf of the value written to the path that has a history
+func (h *historyStore) record(path string, value any, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.rules) == 0 {
+		return
+	}
+
+	WalkLeaves(path, value, func(leafPath string, leafValue any) {
+		size := h.maxSamples(leafPath)
+		if size == 0 {
+			return
+		}
+
+		ring, ok := h.rings[leafPath]
+		if !ok {
+			ring = &sampleRing{size: size}
+			h.rings[leafPath] = ring
+		}
+		ring.add(HistorySample{Time: now, Value: leafValue})
+
+		if h.directory != "" {
+			if err := h.writeSegment(historySegmentSample{Path: leafPath, Time: now, Value: leafValue}); err != nil {
+				log.Printf("Error writing history of '%s': %v", leafPath, err)
+			}
+		}
+	})
+}
+
+// segmentFile returns the path of the segment starting at the time
+func (h *historyStore) segmentFile(start time.Time) string {
+	return filepath.Join(h.directory, strconv.FormatInt(start.Unix(), 10)+".jsonl")
+}
+
+// writeSegment appends a sample to the current segment, starting a new one and deleting the segments past
+// the retention when its time span is over. The caller must hold the lock.
+func (h *historyStore) writeSegment(sample historySegmentSample) error {
+	start := sample.Time.Truncate(h.segmentDuration)
+	if h.segment == nil || !start.Equal(h.segmentStart) {
+		h.closeSegment()
+
+		file, err := os.OpenFile(h.segmentFile(start), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		h.segment, h.segmentStart = file, start
+		h.deleteExpiredSegments(sample.Time)
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = h.segment.Write(append(line, '\n'))
+	return err
+}
+
+func (h *historyStore) closeSegment() {
+	if h.segment != nil {
+		h.segment.Close()
+		h.segment = nil
+	}
+}
+
+// segmentStarts returns the start times of the segments on disk, oldest first
+func (h *historyStore) segmentStarts() []time.Time {
+	entries, err := os.ReadDir(h.directory)
+	if err != nil {
+		return nil
+	}
+
+	var starts []time.Time
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".jsonl")
+		if seconds, err := strconv.ParseInt(name, 10, 64); found && err == nil {
+			starts = append(starts, time.Unix(seconds, 0))
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+// deleteExpiredSegments deletes the segments that ended before the retention
+func (h *historyStore) deleteExpiredSegments(now time.Time) {
+	for _, start := range h.segmentStarts() {
+		if start.Add(h.segmentDuration).Before(now.Add(-h.retention)) {
+			if err := os.Remove(h.segmentFile(start)); err != nil {
+				log.Printf("Error deleting history segment: %v", err)
+			}
+		}
+	}
+}
+
+// hasHistory reports whether the path keeps a history
+func (h *historyStore) hasHistory(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.maxSamples(path) > 0
+}
+
+// samples returns the samples of the path from the time range, oldest first. Samples older than those in memory
+// are read from the on-disk segments.
+func (h *historyStore) samples(path string, from, to time.Time) ([]HistorySample, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var inMemory []HistorySample
+	if ring, ok := h.rings[path]; ok {
+		inMemory = ring.all()
+	}
+
+	samples := []HistorySample{}
+	if h.directory != "" {
+		before := to.Add(time.Nanosecond) // The range includes its end
+		if len(inMemory) > 0 && inMemory[0].Time.Before(before) {
+			before = inMemory[0].Time
+		}
+
+		for _, start := range h.segmentStarts() {
+			if start.Add(h.segmentDuration).Before(from) || !start.Before(before) {
+				continue
+			}
+			segmentSamples, err := readHistorySegment(h.segmentFile(start), path, from, before)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, segmentSamples...)
+		}
+	}
+
+	for _, sample := range inMemory {
+		if !sample.Time.Before(from) && !sample.Time.After(to) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+// readHistorySegment reads the samples of the path from a segment, from the time until before the other
+func readHistorySegment(file, path string, from, before time.Time) ([]HistorySample, error) {
+	segment, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history segment: %w", err)
+	}
+	defer segment.Close()
+
+	var samples []HistorySample
+	scanner := bufio.NewScanner(segment)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var sample historySegmentSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // A line cut short by a crash
+		}
+		if sample.Path == path && !sample.Time.Before(from) && sample.Time.Before(before) {
+			samples = append(samples, HistorySample{Time: sample.Time, Value: sample.Value})
+		}
+	}
+	return samples, scanner.Err()
+}
+
+// Aggregations of the samples in each step of a history
+var historyAggregations = map[string]func(samples []HistorySample) any{
+	"avg": func(samples []HistorySample) any {
+		sum, count := 0.0, 0
+		for _, sample := range samples {
+			if value, ok := sample.Value.(float64); ok {
+				sum, count = sum+value, count+1
+			}
+		}
+		if count == 0 {
+			return nil
+		}
+		return sum / float64(count)
+	},
+	"min": func(samples []HistorySample) any {
+		return extremeSample(samples, math.Min)
+	},
+	"max": func(samples []HistorySample) any {
+		return extremeSample(samples, math.Max)
+	},
+	"last": func(samples []HistorySample) any {
+		return samples[len(samples)-1].Value
+	},
+}
+
+// extremeSample returns the smallest or largest numeric value of the samples, or nil if none are numeric
+func extremeSample(samples []HistorySample, pick func(a, b float64) float64) any {
+	var result any
+	for _, sample := range samples {
+		if value, ok := sample.Value.(float64); ok {
+			if result == nil {
+				result = value
+			} else {
+				result = pick(result.(float64), value)
+			}
+		}
+	}
+	return result
+}
+
+// aggregateHistory groups the samples into steps, with the aggregation of each step's samples.
+// Steps are multiples of the step since the zero time, and those without samples are left out.
+func aggregateHistory(samples []HistorySample, step time.Duration, aggregate func([]HistorySample) any) []HistorySample {
+	result := []HistorySample{}
+	for i := 0; i < len(samples); {
+		stepStart := samples[i].Time.Truncate(step)
+		j := i
+		for j < len(samples) && samples[j].Time.Before(stepStart.Add(step)) {
+			j++
+		}
+		result = append(result, HistorySample{Time: stepStart, Value: aggregate(samples[i:j])})
+		i = j
+	}
+	return result
+}
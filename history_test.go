@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAggregateHistory(t *testing.T) {
+	start := time.Date(2026, 3, 14, 2, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration, value any) HistorySample {
+		return HistorySample{Time: start.Add(offset), Value: value}
+	}
+	samples := []HistorySample{
+		at(0, 1.0),
+		at(20*time.Second, 5.0),
+		at(40*time.Second, 3.0),
+		at(time.Minute, "offline"),
+		at(time.Minute+30*time.Second, 4.0),
+		at(3*time.Minute+10*time.Second, 10.0),
+	}
+
+	tests := []struct {
+		agg     string
+		step    time.Duration
+		samples []HistorySample
+		want    string
+	}{
+		{"avg", time.Minute, samples,
+			`[{"time":"2026-03-14T02:00:00Z","value":3},{"time":"2026-03-14T02:01:00Z","value":4},{"time":"2026-03-14T02:03:00Z","value":10}]`},
+		{"min", time.Minute, samples,
+			`[{"time":"2026-03-14T02:00:00Z","value":1},{"time":"2026-03-14T02:01:00Z","value":4},{"time":"2026-03-14T02:03:00Z","value":10}]`},
+		{"max", time.Minute, samples,
+			`[{"time":"2026-03-14T02:00:00Z","value":5},{"time":"2026-03-14T02:01:00Z","value":4},{"time":"2026-03-14T02:03:00Z","value":10}]`},
+		{"last", time.Minute, samples,
+			`[{"time":"2026-03-14T02:00:00Z","value":3},{"time":"2026-03-14T02:01:00Z","value":4},{"time":"2026-03-14T02:03:00Z","value":10}]`},
+		{"avg", time.Hour, samples,
+			`[{"time":"2026-03-14T02:00:00Z","value":4.6}]`},
+		{"last", 30 * time.Second, samples[2:4],
+			`[{"time":"2026-03-14T02:00:30Z","value":3},{"time":"2026-03-14T02:01:00Z","value":"offline"}]`},
+		{"avg", time.Minute, []HistorySample{at(0, "on"), at(time.Second, true)},
+			`[{"time":"2026-03-14T02:00:00Z","value":null}]`},
+		{"max", time.Minute, nil, `[]`},
+	}
+
+	for _, tt := range tests {
+		got := aggregateHistory(tt.samples, tt.step, historyAggregations[tt.agg])
+		gotJson, _ := json.Marshal(got)
+		if string(gotJson) != tt.want {
+			t.Errorf("aggregateHistory(step %s, %s) = %s, want %s", tt.step, tt.agg, gotJson, tt.want)
+		}
+	}
+}
+
+func TestSampleRing(t *testing.T) {
+	tests := []struct {
+		size  int
+		added int
+		want  []float64
+	}{
+		{3, 0, []float64{}},
+		{3, 2, []float64{1, 2}},
+		{3, 3, []float64{1, 2, 3}},
+		{3, 4, []float64{2, 3, 4}},
+		{3, 8, []float64{6, 7, 8}},
+		{1, 5, []float64{5}},
+	}
+
+	for _, tt := range tests {
+		ring := &sampleRing{size: tt.size}
+		for i := 1; i <= tt.added; i++ {
+			ring.add(HistorySample{Value: float64(i)})
+		}
+
+		got := []float64{}
+		for _, sample := range ring.all() {
+			got = append(got, sample.Value.(float64))
+		}
+		gotJson, _ := json.Marshal(got)
+		wantJson, _ := json.Marshal(tt.want)
+		if string(gotJson) != string(wantJson) {
+			t.Errorf("ring of %d after %d samples = %s, want %s", tt.size, tt.added, gotJson, wantJson)
+		}
+	}
+}
+
+func TestHistorySamplesFromDisk(t *testing.T) {
+	history := newHistoryStore()
+	if err := history.configure(&HistoryConfig{
+		Rules:     []HistoryRule{{Paths: []string{"sensors/**"}, MaxSamples: 2}},
+		Directory: t.TempDir(),
+	}); err != nil {
+		t.Fatalf("configure error = %v", err)
+	}
+
+	start := time.Date(2026, 3, 14, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		history.record("sensors", map[string]any{"temp": float64(i), "humidity": 50.0}, start.Add(time.Duration(i)*time.Minute))
+	}
+	history.record("other", 1.0, start)
+
+	tests := []struct {
+		name     string
+		path     string
+		from, to time.Time
+		want     []float64
+	}{
+		{"memory and disk", "sensors/temp", time.Time{}, start.Add(time.Hour), []float64{0, 1, 2, 3, 4}},
+		{"only disk", "sensors/temp", start.Add(time.Minute), start.Add(2 * time.Minute), []float64{1, 2}},
+		{"only memory", "sensors/temp", start.Add(4 * time.Minute), start.Add(time.Hour), []float64{4}},
+		{"path without history", "other", time.Time{}, start.Add(time.Hour), []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := history.samples(tt.path, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("samples error = %v", err)
+			}
+			got := []float64{}
+			for _, sample := range samples {
+				got = append(got, sample.Value.(float64))
+			}
+			gotJson, _ := json.Marshal(got)
+			wantJson, _ := json.Marshal(tt.want)
+			if string(gotJson) != string(wantJson) {
+				t.Errorf("samples(%q) = %s, want %s", tt.path, gotJson, wantJson)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HistoryHandler handles requests for the past values of a model path
+func (s *Server) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+		return
+	}
+
+	path := strings.Join(extractPathTokens(r.URL.Path, "/history"), "/")
+	if err := validateModelPath(path); err != nil {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid history path: %w", err))
+		return
+	}
+
+	if policy := accessPolicyFromRequest(r); !policy.Allows(http.MethodGet, "/model/"+path) {
+		sendErrorResponse(w, r, policy.forbidden(r.Method, r.URL.Path))
+		return
+	}
+	if !s.dataModel.history.hasHistory(path) {
+		sendErrorResponse(w, r, newError(ErrNotFound, "no history is kept for '%s'", path))
+		return
+	}
+
+	params := r.URL.Query()
+	var from time.Time
+	to := time.Now()
+	var err error
+	if param := params.Get("from"); param != "" {
+		if from, err = parseTimeParam("from", param); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+	}
+	if param := params.Get("to"); param != "" {
+		if to, err = parseTimeParam("to", param); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var step time.Duration
+	if param := params.Get("step"); param != "" {
+		if step, err = time.ParseDuration(param); err != nil || step <= 0 {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid 'step' '%s', expected a positive duration", param))
+			return
+		}
+	}
+
+	aggregate := historyAggregations["avg"]
+	if param := params.Get("agg"); param != "" {
+		var ok bool
+		if aggregate, ok = historyAggregations[param]; !ok {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid 'agg' '%s', expected 'avg', 'min', 'max' or 'last'", param))
+			return
+		}
+		if step == 0 {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "'agg' needs a 'step'"))
+			return
+		}
+	}
+
+	samples, err := s.dataModel.history.samples(path, from, to)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+	if step > 0 {
+		samples = aggregateHistory(samples, step, aggregate)
+	}
+
+	sendJSONResponse(w, samples, http.StatusOK)
+}
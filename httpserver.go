@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultListenAddress is used when neither the config nor LISTEN_ADDRESS sets the listen addresses
+const defaultListenAddress = ":8080"
+
+// certificateCheckInterval is how often new connections check whether the certificate files have changed
+const certificateCheckInterval = time.Second
+
+// ServerConfig configures the HTTP listeners. Changes to the listeners and TLS take effect when the server is restarted.
+type ServerConfig struct {
+	Listen         []string      `json:"listen,omitempty"`         // Addresses to serve the API on, ":8080" by default
+	Tls            *TlsConfig    `json:"tls,omitempty"`            // Serves HTTPS instead of HTTP if set
+	RedirectListen string        `json:"redirectListen,omitempty"` // Address of a plain HTTP listener redirecting to HTTPS
+	Cors           *CorsConfig   `json:"cors,omitempty"`           // Cross-origin requests from browsers, applied without a restart
+	Limits         *LimitsConfig `json:"limits,omitempty"`         // Body sizes, rate limits and write throttling, applied without a restart
+}
+
+// TlsConfig configures HTTPS, and optionally mutual TLS
+type TlsConfig struct {
+	CertFile     string `json:"certFile"`               // PEM certificate chain, reloaded when it changes
+	KeyFile      string `json:"keyFile"`                // PEM private key, reloaded when it changes
+	ClientCaFile string `json:"clientCaFile,omitempty"` // PEM CAs that client certificates must be signed by
+	ClientAuth   string `json:"clientAuth,omitempty"`   // "required" (default) or "optional" client certificates
+}
+
+// listenAddresses returns the configured listen addresses, or LISTEN_ADDRESS, or the default
+func (c *ServerConfig) listenAddresses() []string {
+	if c != nil && len(c.Listen) > 0 {
+		return c.Listen
+	}
+	if address := os.Getenv("LISTEN_ADDRESS"); address != "" {
+		return []string{address}
+	}
+	return []string{defaultListenAddress}
+}
+
+// certificateReloader provides a certificate loaded from files, reloading it when the files change
+type certificateReloader struct {
+	certFile, keyFile string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time // Modification times of the certificate and key files when they were loaded
+	lastCheck   time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// load reads the certificate and key. The caller must hold the lock, unless the reloader isn't in use yet.
+func (c *certificateReloader) load() error {
+	modTimes, err := c.currentModTimes()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate and key: %w", err)
+	}
+
+	c.certificate, c.modTimes = &certificate, modTimes
+	return nil
+}
+
+// currentModTimes returns the modification times of the certificate and key files
+func (c *certificateReloader) currentModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("error reading TLS file: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// GetCertificate returns the certificate for a new connection, first reloading it if the files have changed.
+// If reloading fails, e.g. because only one of the files has been replaced so far, the previous certificate is used.
+func (c *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastCheck) >= certificateCheckInterval {
+		c.lastCheck = time.Now()
+		if modTimes, err := c.currentModTimes(); err == nil && modTimes != c.modTimes {
+			if err := c.load(); err != nil {
+				log.Printf("Error reloading TLS certificate, still using the previous one: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate from %s", c.certFile)
+			}
+		}
+	}
+
+	return c.certificate, nil
+}
+
+// newServerTLSConfig creates the TLS configuration of the HTTPS listeners
+func newServerTLSConfig(config *TlsConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("'tls' needs a 'certFile' and a 'keyFile'")
+	}
+
+	reloader, err := newCertificateReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if config.ClientCaFile != "" {
+		caCert, err := os.ReadFile(config.ClientCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA certificate: %w", err)
+		}
+
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse client CA certificate")
+		}
+		tlsConfig.ClientCAs = clientCAs
+
+		switch config.ClientAuth {
+		case "", "required":
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown 'clientAuth' '%s', expected 'required' or 'optional'", config.ClientAuth)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// redirectToHTTPS creates a handler redirecting requests to the same URL on the HTTPS address
+func redirectToHTTPS(httpsAddress string) http.HandlerFunc {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddress)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = hostname
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// tlsConfig checks the configuration, returning the TLS configuration of the listeners, or nil for plain HTTP
+func (c *ServerConfig) tlsConfig() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Tls == nil {
+		if c.RedirectListen != "" {
+			return nil, newError(ErrBadRequest, "invalid server config: 'redirectListen' needs 'tls'")
+		}
+		return nil, nil
+	}
+
+	tlsConfig, err := newServerTLSConfig(c.Tls)
+	if err != nil {
+		return nil, newError(ErrBadRequest, "invalid server config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// ListenAndServe serves the handler on the configured addresses, using HTTPS if TLS is configured,
+// until one of the listeners fails
+func ListenAndServe(config *ServerConfig, handler http.Handler) error {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	addresses := config.listenAddresses()
+	errs := make(chan error, len(addresses)+1)
+
+	for _, address := range addresses {
+		httpServer := &http.Server{Addr: address, Handler: handler, TLSConfig: tlsConfig}
+		go func() {
+			if tlsConfig != nil {
+				fmt.Printf("Server starting on %s with HTTPS...\n", address)
+				errs <- httpServer.ListenAndServeTLS("", "")
+			} else {
+				fmt.Printf("Server starting on %s...\n", address)
+				errs <- httpServer.ListenAndServe()
+			}
+		}()
+	}
+
+	if config != nil && config.RedirectListen != "" {
+		go func() {
+			fmt.Printf("Redirecting HTTP on %s to HTTPS...\n", config.RedirectListen)
+			errs <- http.ListenAndServe(config.RedirectListen, redirectToHTTPS(addresses[0]))
+		}()
+	}
+
+	return <-errs
+}
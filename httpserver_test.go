@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a new self-signed certificate and its key with the modification time, returning the
+// certificate's DER bytes. Either file name may be empty to leave that file alone.
+func writeTestCertificate(t *testing.T, certFile, keyFile, name string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate error = %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey error = %v", err)
+	}
+
+	files := map[string][]byte{
+		certFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+	for file, contents := range files {
+		if file == "" {
+			continue
+		}
+		if err := os.WriteFile(file, contents, 0600); err != nil {
+			t.Fatalf("WriteFile error = %v", err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes error = %v", err)
+		}
+	}
+	return der
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	modTime := time.Now().Add(-time.Hour)
+
+	first := writeTestCertificate(t, certFile, keyFile, "first.example.com", modTime)
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertificateReloader error = %v", err)
+	}
+
+	// current returns the certificate served to new connections, checking the files as if the interval had passed
+	current := func(check bool) []byte {
+		t.Helper()
+		if check {
+			reloader.mu.Lock()
+			reloader.lastCheck = time.Time{}
+			reloader.mu.Unlock()
+		}
+		certificate, err := reloader.GetCertificate(nil)
+		if err != nil || certificate == nil {
+			t.Fatalf("GetCertificate() = %v, error %v", certificate, err)
+		}
+		return certificate.Certificate[0]
+	}
+
+	if !bytes.Equal(current(true), first) {
+		t.Fatal("GetCertificate() didn't return the loaded certificate")
+	}
+
+	// A rotated pair is picked up at the next check
+	second := writeTestCertificate(t, certFile, keyFile, "second.example.com", modTime.Add(time.Minute))
+	if !bytes.Equal(current(false), first) {
+		t.Error("GetCertificate() reloaded the files before the check interval passed")
+	}
+	if !bytes.Equal(current(true), second) {
+		t.Error("GetCertificate() didn't pick up the rotated certificate")
+	}
+
+	// A certificate that doesn't match the key, e.g. while only one file has been replaced, keeps the previous one
+	writeTestCertificate(t, certFile, "", "third.example.com", modTime.Add(2*time.Minute))
+	if !bytes.Equal(current(true), second) {
+		t.Error("GetCertificate() didn't keep the previous certificate for a mismatched pair")
+	}
+
+	// So does a file that isn't a certificate at all
+	os.WriteFile(certFile, []byte("not a certificate"), 0600)
+	os.Chtimes(certFile, modTime.Add(3*time.Minute), modTime.Add(3*time.Minute))
+	if !bytes.Equal(current(true), second) {
+		t.Error("GetCertificate() didn't keep the previous certificate for an invalid file")
+	}
+
+	// And a missing key
+	os.Remove(keyFile)
+	if !bytes.Equal(current(true), second) {
+		t.Error("GetCertificate() didn't keep the previous certificate for a missing key")
+	}
+
+	// Once the pair is complete again, it is loaded
+	third := writeTestCertificate(t, certFile, keyFile, "third.example.com", modTime.Add(4*time.Minute))
+	if !bytes.Equal(current(true), third) {
+		t.Error("GetCertificate() didn't pick up the certificate after the broken pair was fixed")
+	}
+}
+
+func TestNewCertificateReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	if _, err := newCertificateReloader(certFile, keyFile); err == nil {
+		t.Error("newCertificateReloader() with missing files succeeded, want an error")
+	}
+
+	writeTestCertificate(t, certFile, keyFile, "first.example.com", time.Now())
+	writeTestCertificate(t, certFile, "", "second.example.com", time.Now())
+	if _, err := newCertificateReloader(certFile, keyFile); err == nil {
+		t.Error("newCertificateReloader() with a mismatched pair succeeded, want an error")
+	}
+}
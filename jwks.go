@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jsonWebKey is a key in a JSON Web Key Set (RFC 7517), with the fields of RSA, EC, OKP and symmetric keys
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJwks reads the keys of a JSON Web Key Set file, keyed by their key ID
+func loadJwks(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JWKS file: %w", err)
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &keySet); err != nil {
+		return nil, fmt.Errorf("error parsing JWKS file: %w", err)
+	}
+
+	keys := make(map[string]any)
+	for i, jwk := range keySet.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %d ('%s'): %w", i, jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// publicKey converts the key into the type the JWT library verifies signatures with
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'n': %w", err)
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'e': %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'x': %w", err)
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'y': %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid 'x'")
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		k, err := decodeBase64URL(jwk.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'k': %w", err)
+		}
+		return k, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", jwk.Kty)
+	}
+}
+
+// decodeBase64URL decodes unpadded base64url, as used by JWKs
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
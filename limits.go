@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultMaxBodyBytes limits request bodies to 1MB unless configured otherwise, to prevent DOS attacks
+const defaultMaxBodyBytes = 1 << 20
+
+// minPruneSize is the number of tracked clients or paths below which idle entries aren't pruned
+const minPruneSize = 1024
+
+// LimitsConfig bounds what clients can make the server do
+type LimitsConfig struct {
+	MaxBodyBytes      int64               `json:"maxBodyBytes,omitempty"`      // Size limit of request bodies, 1MB by default
+	RouteMaxBodyBytes map[string]int64    `json:"routeMaxBodyBytes,omitempty"` // key: route like "/config", value: its body size limit
+	RateLimit         *RateLimitConfig    `json:"rateLimit,omitempty"`         // Requests each client may make
+	WriteThrottle     []WriteThrottleRule `json:"writeThrottle,omitempty"`     // How often clients may write model paths
+}
+
+// RateLimitConfig configures a token bucket for each client, identified by its credentials or IP address
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"` // Rate at which the bucket refills
+	Burst             int     `json:"burst,omitempty"`   // Size of the bucket, the rate rounded up by default
+}
+
+// WriteThrottleRule limits how often clients may write each model path matching its globs
+type WriteThrottleRule struct {
+	Paths       []string `json:"paths"`       // Globs of model paths, e.g. "sensors/**"
+	MinInterval string   `json:"minInterval"` // Minimum time between writes of a path, e.g. "500ms"
+}
+
+// limiter applies the limits of the configuration. A nil limiter applies the default body size limit only.
+type limiter struct {
+	maxBodyBytes      int64
+	routeMaxBodyBytes map[string]int64
+	rate              *rateLimiter
+	throttle          *writeThrottle
+}
+
+// newLimiter checks the configuration and prepares its limiter
+func newLimiter(config *LimitsConfig) (*limiter, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	l := &limiter{maxBodyBytes: config.MaxBodyBytes, routeMaxBodyBytes: config.RouteMaxBodyBytes}
+	if l.maxBodyBytes < 0 {
+		return nil, fmt.Errorf("'maxBodyBytes' can't be negative")
+	}
+	for route, maxBytes := range l.routeMaxBodyBytes {
+		if maxBytes <= 0 {
+			return nil, fmt.Errorf("'routeMaxBodyBytes' of '%s' must be positive", route)
+		}
+	}
+
+	if config.RateLimit != nil {
+		if config.RateLimit.RequestsPerSecond <= 0 || config.RateLimit.Burst < 0 {
+			return nil, fmt.Errorf("'rateLimit' needs a positive 'requestsPerSecond' and 'burst'")
+		}
+		l.rate = newRateLimiter(config.RateLimit.RequestsPerSecond, config.RateLimit.Burst)
+	}
+
+	if len(config.WriteThrottle) > 0 {
+		throttle, err := newWriteThrottle(config.WriteThrottle)
+		if err != nil {
+			return nil, err
+		}
+		l.throttle = throttle
+	}
+
+	return l, nil
+}
+
+// bodyLimit returns the size limit of the bodies of requests to the path, using the most specific route
+func (l *limiter) bodyLimit(requestPath string) int64 {
+	if l == nil {
+		return defaultMaxBodyBytes
+	}
+
+	limit, longestRoute := l.maxBodyBytes, ""
+	for route, maxBytes := range l.routeMaxBodyBytes {
+		if isSubPath(requestPath, route) && len(route) > len(longestRoute) {
+			limit, longestRoute = maxBytes, route
+		}
+	}
+	if limit == 0 {
+		return defaultMaxBodyBytes
+	}
+	return limit
+}
+
+// allowRequest takes a token from the client's bucket, returning how long to wait if it's empty
+func (l *limiter) allowRequest(client string) (bool, time.Duration) {
+	if l == nil || l.rate == nil {
+		return true, 0
+	}
+	return l.rate.allow(client)
+}
+
+// writeThrottle returns the throttle of model writes, which is nil if writes aren't throttled
+func (l *limiter) writeThrottle() *writeThrottle {
+	if l == nil {
+		return nil
+	}
+	return l.throttle
+}
+
+// rateLimiter keeps a token bucket for each client
+type rateLimiter struct {
+	rate    float64 // Tokens added per second
+	burst   float64 // Maximum number of tokens
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruneAt int
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst == 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket), pruneAt: minPruneSize}
+}
+
+// allow takes a token from the client's bucket, returning how long until there is one if it's empty
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		l.prune(now)
+		bucket = &tokenBucket{tokens: l.burst}
+		l.buckets[client] = bucket
+	} else {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// prune forgets the clients whose buckets have refilled, once there are many of them
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) < l.pruneAt {
+		return
+	}
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.pruneAt = max(minPruneSize, 2*len(l.buckets))
+}
+
+// writeThrottle tracks when model paths may be written again
+type writeThrottle struct {
+	rules   []throttleRule
+	mu      sync.Mutex
+	next    map[string]time.Time // key: model path, value: when it may be written again
+	pruneAt int
+}
+
+type throttleRule struct {
+	paths    []string
+	interval time.Duration
+}
+
+func newWriteThrottle(rules []WriteThrottleRule) (*writeThrottle, error) {
+	throttle := &writeThrottle{next: make(map[string]time.Time), pruneAt: minPruneSize}
+	for i, rule := range rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("write throttle rule %d needs 'paths'", i)
+		}
+		interval, err := time.ParseDuration(rule.MinInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("write throttle rule %d needs a positive 'minInterval' like \"500ms\"", i)
+		}
+		throttle.rules = append(throttle.rules, throttleRule{paths: rule.Paths, interval: interval})
+	}
+	return throttle, nil
+}
+
+// interval returns the longest interval of the rules matching the model path, or 0 if none match
+func (t *writeThrottle) interval(modelPath string) time.Duration {
+	var interval time.Duration
+	for _, rule := range t.rules {
+		for _, pattern := range rule.paths {
+			if matchPathGlob(pattern, modelPath) {
+				interval = max(interval, rule.interval)
+			}
+		}
+	}
+	return interval
+}
+
+// checkWrite rejects a write of the model path if the path was written too recently. Writes are only counted
+// once recordWrite is called after they succeed, so that failed writes don't delay the next one.
+// A nil throttle allows every write.
+func (t *writeThrottle) checkWrite(modelPath string) error {
+	if t == nil {
+		return nil
+	}
+	interval := t.interval(modelPath)
+	if interval == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if next, ok := t.next[modelPath]; ok && now.Before(next) {
+		wait := next.Sub(now)
+		return retryAfter(newError(ErrTooManyRequests, "'%s' may only be written every %s, retry in %s",
+			modelPath, interval, wait.Round(time.Millisecond)), wait)
+	}
+	return nil
+}
+
+// recordWrite records a successful write of the model path, which may not be written again until its interval
+// has passed
+func (t *writeThrottle) recordWrite(modelPath string) {
+	if t == nil {
+		return
+	}
+	interval := t.interval(modelPath)
+	if interval == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+	t.next[modelPath] = now.Add(interval)
+}
+
+// prune forgets the paths that may be written again, once there are many of them
+func (t *writeThrottle) prune(now time.Time) {
+	if len(t.next) < t.pruneAt {
+		return
+	}
+	for modelPath, next := range t.next {
+		if !now.Before(next) {
+			delete(t.next, modelPath)
+		}
+	}
+	t.pruneAt = max(minPruneSize, 2*len(t.next))
+}
+
+// limiter checks the server's limits configuration, returning its limiter
+func (c *ServerConfig) limiter() (*limiter, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	l, err := newLimiter(c.Limits)
+	if err != nil {
+		return nil, newError(ErrBadRequest, "invalid server config: %w", err)
+	}
+	return l, nil
+}
+
+// limited wraps the server's routes so that request bodies can't exceed the size limit of their route
+func (s *Server) limited(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, s.limits.Load().bodyLimit(r.URL.Path))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// rateLimited checks the rate limit of the client, which is identified by its principal if it has
+// authenticated with a name of its own, and by its IP address otherwise
+func (s *Server) rateLimited(r *http.Request, principal *Principal) error {
+	client := "ip:" + r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = "ip:" + host
+	}
+	if principal != nil && !principal.Unnamed {
+		client = "principal:" + principal.Name
+	}
+
+	if allowed, wait := s.limits.Load().allowRequest(client); !allowed {
+		return retryAfter(newError(ErrTooManyRequests, "rate limit exceeded, retry in %s", wait.Round(time.Millisecond)), wait)
+	}
+	return nil
+}
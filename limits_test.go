@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		allowed int // Requests allowed in a row before the bucket is empty
+	}{
+		{"explicit burst", 1, 3, 3},
+		{"burst defaults to the rate rounded up", 2.5, 0, 3},
+		{"slow rate", 0.1, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.rate, tt.burst)
+			for i := 0; i < tt.allowed; i++ {
+				if ok, _ := limiter.allow("client"); !ok {
+					t.Fatalf("request %d denied, want %d allowed", i+1, tt.allowed)
+				}
+			}
+
+			ok, wait := limiter.allow("client")
+			if ok {
+				t.Fatalf("request %d allowed, want the bucket empty", tt.allowed+1)
+			}
+			if maxWait := time.Duration(float64(time.Second) / tt.rate); wait <= 0 || wait > maxWait {
+				t.Errorf("wait = %s, want up to %s", wait, maxWait)
+			}
+
+			if ok, _ := limiter.allow("other"); !ok {
+				t.Error("another client's request denied, want a bucket of its own")
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(10, 1)
+	if ok, _ := limiter.allow("client"); !ok {
+		t.Fatal("first request denied")
+	}
+
+	// Refilling takes a tenth of a second
+	limiter.buckets["client"].updated = time.Now().Add(-100 * time.Millisecond)
+	if ok, _ := limiter.allow("client"); !ok {
+		t.Error("request denied after the bucket refilled")
+	}
+}
+
+func TestWriteThrottle(t *testing.T) {
+	throttle, err := newWriteThrottle([]WriteThrottleRule{
+		{Paths: []string{"sensors/**"}, MinInterval: "1h"},
+		{Paths: []string{"sensors/fast"}, MinInterval: "1ms"},
+	})
+	if err != nil {
+		t.Fatalf("newWriteThrottle error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		failed  bool // Whether the write fails after passing the check, so it isn't recorded
+		wantErr bool
+	}{
+		{"failed write", "sensors/temp", true, false},
+		{"first write", "sensors/temp", false, false},
+		{"second write", "sensors/temp", false, true},
+		{"other path", "sensors/humidity", false, false},
+		{"longest interval applies", "sensors/fast", false, false},
+		{"longest interval applies again", "sensors/fast", false, true},
+		{"unthrottled path", "setpoints/temp", false, false},
+		{"unthrottled path again", "setpoints/temp", false, false},
+	}
+
+	for _, tt := range tests {
+		err := throttle.checkWrite(tt.path)
+		if tt.wantErr && !errors.Is(err, ErrTooManyRequests) {
+			t.Errorf("%s: checkWrite(%q) error = %v, want too_many_requests", tt.name, tt.path, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: checkWrite(%q) error = %v", tt.name, tt.path, err)
+		}
+		if err == nil && !tt.failed {
+			throttle.recordWrite(tt.path)
+		}
+	}
+
+	var nilThrottle *writeThrottle
+	nilThrottle.recordWrite("sensors/temp")
+	if err := nilThrottle.checkWrite("sensors/temp"); err != nil {
+		t.Errorf("nil throttle checkWrite error = %v", err)
+	}
+}
+
+func TestModelHandlerThrottlesOnlySuccessfulWrites(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"setpoint": 20}, "transformations": {
+		"setpoint": {"onWrite": "self > 30 ? notDefined : self"}}}`)
+	server := CreateServer(*dataModel)
+	limits, err := newLimiter(&LimitsConfig{WriteThrottle: []WriteThrottleRule{{Paths: []string{"setpoint"}, MinInterval: "1h"}}})
+	if err != nil {
+		t.Fatalf("newLimiter error = %v", err)
+	}
+	server.limits.Store(limits)
+
+	// Writes rejected by onWrite or by validation don't keep the next write from succeeding
+	tests := []struct {
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"/model/setpoint", `40`, http.StatusUnprocessableEntity},
+		{"/model/setpoint?quality=excellent", `21`, http.StatusBadRequest},
+		{"/model/setpoint", `21`, http.StatusOK},
+		{"/model/setpoint", `22`, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ModelHandler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("POST %s to %s status = %d, want %d: %s", tt.body, tt.target, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+	if value := server.dataModel.Model["setpoint"]; value != 21.0 {
+		t.Errorf("setpoint = %v, want 21", value)
+	}
+}
+
+func TestRateLimitedClients(t *testing.T) {
+	server := CreateServer(*NewDataModel())
+	limits, err := newLimiter(&LimitsConfig{RateLimit: &RateLimitConfig{RequestsPerSecond: 0.001, Burst: 1}})
+	if err != nil {
+		t.Fatalf("newLimiter error = %v", err)
+	}
+	server.limits.Store(limits)
+
+	request := func(address string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/model", nil)
+		r.RemoteAddr = address + ":1234"
+		return r
+	}
+	named := &Principal{Name: "line-1"}
+	unnamed := &Principal{Name: "jwt", Unnamed: true}
+
+	tests := []struct {
+		name      string
+		address   string
+		principal *Principal
+		wantErr   bool
+	}{
+		{"named client", "192.0.2.1", named, false},
+		{"named client from another address", "192.0.2.2", named, true},
+		{"unnamed client", "192.0.2.3", unnamed, false},
+		{"another unnamed client", "192.0.2.4", unnamed, false},
+		{"unnamed client again", "192.0.2.3", unnamed, true},
+		{"anonymous client at the same address", "192.0.2.4", nil, true},
+	}
+
+	for _, tt := range tests {
+		err := server.rateLimited(request(tt.address), tt.principal)
+		if tt.wantErr != errors.Is(err, ErrTooManyRequests) {
+			t.Errorf("%s: rateLimited() error = %v, want rate limited %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewWriteThrottleRejectsInvalidRules(t *testing.T) {
+	tests := []WriteThrottleRule{
+		{MinInterval: "1s"},
+		{Paths: []string{"a"}, MinInterval: "soon"},
+		{Paths: []string{"a"}, MinInterval: "0s"},
+	}
+
+	for _, rule := range tests {
+		if _, err := newWriteThrottle([]WriteThrottleRule{rule}); err == nil {
+			t.Errorf("newWriteThrottle(%+v) succeeded, want an error", rule)
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	l, err := newLimiter(&LimitsConfig{MaxBodyBytes: 2048, RouteMaxBodyBytes: map[string]int64{"/config": 4096, "/model/blobs": 8192}})
+	if err != nil {
+		t.Fatalf("newLimiter error = %v", err)
+	}
+
+	tests := []struct {
+		limiter *limiter
+		path    string
+		want    int64
+	}{
+		{nil, "/model", defaultMaxBodyBytes},
+		{l, "/model", 2048},
+		{l, "/config", 4096},
+		{l, "/model/blobs/a", 8192},
+		{l, "/configs", 2048},
+	}
+
+	for _, tt := range tests {
+		if got := tt.limiter.bodyLimit(tt.path); got != tt.want {
+			t.Errorf("bodyLimit(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
@@ -2,22 +2,43 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server encapsulates the HTTP server and its dependencies
 type Server struct {
 	dataModel DataModel
+	scheduler *Scheduler
+	mu        *sync.Mutex                   // The data model's lock, which is kept when the data model is replaced
+	auth      atomic.Pointer[Authenticator] // Checks credentials without holding the lock
+	cors      atomic.Pointer[corsPolicy]    // Allows cross-origin requests, or nil if they aren't configured
+	limits    atomic.Pointer[limiter]       // Limits body sizes, request rates and writes
 }
 
 // CreateServer creates a new server with the given data model
 func CreateServer(dataModel DataModel) *Server {
-	return &Server{
+	server := &Server{
 		dataModel: dataModel,
+		mu:        dataModel.mu,
+	}
+	server.scheduler = NewScheduler(&server.dataModel)
+	return server
+}
+
+// synchronized wraps a handler so that it has exclusive access to the data model
+func (s *Server) synchronized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handler(w, r)
 	}
 }
 
@@ -26,24 +47,36 @@ func extractPathTokens(path, prefix string) []string {
 	return GetStrTokens(path, prefix, "/")
 }
 
+// readBody reads the request body, which the server's limits keep from exceeding the size limit of the route
+func readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, newError(ErrRequestTooLarge, "request body is larger than %d bytes", maxBytesErr.Limit)
+		}
+		return nil, newError(ErrBadRequest, "error reading request body: %w", err)
+	}
+	return body, nil
+}
+
 // readJSONBody reads and parses the JSON request body
 func readJSONBody(w http.ResponseWriter, r *http.Request) (any, error) {
 	contentType := r.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "application/json") {
-		return nil, fmt.Errorf("unsupported Content-Type: %s, only application/json is supported", contentType)
+		return nil, newError(ErrUnsupportedMediaType, "unsupported Content-Type: %s, only application/json is supported", contentType)
 	}
 
-	// Limit request body size to 1MB to prevent DOS attacks
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
-		return nil, fmt.Errorf("error reading request body: %w", err)
+		return nil, err
 	}
 
 	var jsonData any
 	if err := json.Unmarshal(body, &jsonData); err != nil {
-		return nil, fmt.Errorf("invalid JSON format: %w", err)
+		return nil, newError(ErrBadRequest, "invalid JSON format: %w", err)
 	}
 
 	return jsonData, nil
@@ -57,25 +90,57 @@ func sendJSONResponse(w http.ResponseWriter, data any, statusCode int) error {
 	return json.NewEncoder(w).Encode(data)
 }
 
-// sendErrorResponse sends an error response with the appropriate status code
-func sendErrorResponse(w http.ResponseWriter, err error) {
-	statusCode := http.StatusInternalServerError
+// formatETag formats a model version as a strong entity tag
+func formatETag(version ModelVersion) string {
+	return fmt.Sprintf("\"%d\"", version.Version)
+}
+
+// setVersionHeaders adds the ETag and Last-Modified headers describing a model version to the response
+func setVersionHeaders(w http.ResponseWriter, version ModelVersion) {
+	w.Header().Set("ETag", formatETag(version))
+	w.Header().Set("Last-Modified", version.Modified.UTC().Format(http.TimeFormat))
+}
+
+// etagListMatches reports whether a comma-separated If-Match or If-None-Match header contains the entity tag.
+// Weak tags are compared by their value, since the model's versions are exact.
+func etagListMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified reports whether a GET request's If-None-Match or If-Modified-Since header shows that the client
+// already has the version. If-Modified-Since is only considered without If-None-Match.
+func isNotModified(r *http.Request, version ModelVersion) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagListMatches(ifNoneMatch, formatETag(version))
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		return err == nil && !version.Modified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
 
-	// Determine appropriate status code based on error message
-	errMsg := err.Error()
-	switch {
-	case strings.Contains(errMsg, "not found"):
-		statusCode = http.StatusNotFound
-	case strings.Contains(errMsg, "method"):
-		statusCode = http.StatusMethodNotAllowed
-	case strings.Contains(errMsg, "Content-Type"):
-		statusCode = http.StatusUnsupportedMediaType
-	case strings.Contains(errMsg, "does not point to") ||
-		strings.Contains(errMsg, "invalid JSON"):
-		statusCode = http.StatusBadRequest
+// checkIfMatch returns an error if a write request has an If-Match header that doesn't match the current version
+func checkIfMatch(r *http.Request, version ModelVersion) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagListMatches(ifMatch, formatETag(version)) {
+		return nil
 	}
+	return newError(ErrPreconditionFailed, "precondition failed: the current version is %s", formatETag(version))
+}
 
-	http.Error(w, errMsg, statusCode)
+// qualityParam reads the quality a writer reports for the value with ?quality=
+func qualityParam(r *http.Request) (string, error) {
+	quality := r.URL.Query().Get("quality")
+	return quality, validateQuality(quality)
 }
 
 // ModelHandler handles requests to the model endpoint
@@ -83,35 +148,85 @@ func (s *Server) ModelHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s request to %s", r.Method, r.URL.Path)
 
 	pathTokens := extractPathTokens(r.URL.Path, "/model")
+	path := strings.Join(pathTokens, "/")
 
 	switch r.Method {
 	case http.MethodGet:
-		result, err := s.dataModel.GetModelData(pathTokens, r.URL.Query().Get("raw") == "y")
+		queryOptions, err := parseQueryOptions(r.URL.Query())
 		if err != nil {
-			sendErrorResponse(w, fmt.Errorf("error getting data: %w", err))
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		result, err := s.dataModel.GetModelDataWithOptions(pathTokens, ReadOptions{
+			Raw:          r.URL.Query().Get("raw") == "y",
+			InlineErrors: r.URL.Query().Get("errors") == "inline",
+		})
+		if err != nil {
+			sendErrorResponse(w, r, fmt.Errorf("error getting data: %w", err))
+			return
+		}
+
+		policy := accessPolicyFromRequest(r)
+		result, readable := policy.FilterReadable(path, result)
+		if !readable {
+			sendErrorResponse(w, r, policy.forbidden(r.Method, r.URL.Path))
+			return
+		}
+
+		if result, err = queryOptions.apply(result); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		if queryOptions.Meta {
+			result = ValueWithMetadata{Value: result, Meta: s.dataModel.ReadableMetadata(path, policy)}
+		}
+
+		// The version is determined after reading, once the paths read by the transformations are known
+		version := s.dataModel.PathVersion(path)
+		setVersionHeaders(w, version)
+		if isNotModified(r, version) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
 		if err := sendJSONResponse(w, result, http.StatusOK); err != nil {
-			sendErrorResponse(w, fmt.Errorf("error encoding response: %w", err))
+			sendErrorResponse(w, r, fmt.Errorf("error encoding response: %w", err))
+		}
+
+	case http.MethodPost, http.MethodPut:
+		if err := checkIfMatch(r, s.dataModel.PathVersion(path)); err != nil {
+			sendErrorResponse(w, r, err)
+			return
 		}
 
-	case http.MethodPost:
 		jsonData, err := readJSONBody(w, r)
 		if err != nil {
-			sendErrorResponse(w, err)
+			sendErrorResponse(w, r, err)
 			return
 		}
 
-		if err := s.dataModel.SetModelData(pathTokens, jsonData, false); err != nil {
-			sendErrorResponse(w, err)
+		throttle := s.limits.Load().writeThrottle()
+		if err := throttle.checkWrite(path); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		source := httpSource(r)
+		if source.Quality, err = qualityParam(r); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		if err := s.dataModel.SetModelData(pathTokens, jsonData, source); err != nil {
+			sendErrorResponse(w, r, err)
 			return
 		}
+		throttle.recordWrite(path)
 
+		setVersionHeaders(w, s.dataModel.PathVersion(path))
 		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
 
 	default:
-		sendErrorResponse(w, fmt.Errorf("method %s not supported", r.Method))
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
 	}
 }
 
@@ -120,36 +235,58 @@ func (s *Server) NodeHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s request to %s", r.Method, r.URL.Path)
 
 	if r.Method != http.MethodPost {
-		sendErrorResponse(w, fmt.Errorf("method %s not supported", r.Method))
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
 		return
 	}
 
 	pathTokens := extractPathTokens(r.URL.Path, "/node")
 	if len(pathTokens) != 1 {
-		sendErrorResponse(w, fmt.Errorf("expected only one item in the path, got %d", len(pathTokens)))
+		sendErrorResponse(w, r, newError(ErrBadRequest, "expected only one item in the path, got %d", len(pathTokens)))
 		return
 	}
 
 	normalizedPath := strings.Join(pathTokens, "/")
 	paths, exists := s.dataModel.Nodes[normalizedPath]
 	if !exists {
-		sendErrorResponse(w, fmt.Errorf("no match in the nodes list for the path \"%s\"", normalizedPath))
+		sendErrorResponse(w, r, newError(ErrNotFound, "no match in the nodes list for the path \"%s\"", normalizedPath))
 		return
 	}
 
 	jsonData, err := readJSONBody(w, r)
 	if err != nil {
-		sendErrorResponse(w, err)
+		sendErrorResponse(w, r, err)
 		return
 	}
 
+	// A path the client may not write or that is throttled rejects the whole update, before anything is written
+	policy := accessPolicyFromRequest(r)
+	throttle := s.limits.Load().writeThrottle()
+	for _, path := range paths {
+		modelPath := strings.Join(GetStrTokens(path, "/", "/"), "/")
+		if err := policy.checkWrite(http.MethodPost, modelPath); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		if err := throttle.checkWrite(modelPath); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	// Update all paths associated with this node
+	source := httpSource(r)
+	source.Node = normalizedPath
+	if source.Quality, err = qualityParam(r); err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
 	for _, path := range paths {
 		curTokens := GetStrTokens(path, "/", "/")
-		if err := s.dataModel.SetModelData(curTokens, jsonData, false); err != nil {
-			sendErrorResponse(w, err)
+		if err := s.dataModel.SetModelData(curTokens, jsonData, source); err != nil {
+			sendErrorResponse(w, r, err)
 			return
 		}
+		throttle.recordWrite(strings.Join(curTokens, "/"))
 	}
 
 	sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
@@ -162,36 +299,93 @@ func (s *Server) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		if err := sendJSONResponse(w, s.dataModel, http.StatusOK); err != nil {
-			sendErrorResponse(w, fmt.Errorf("error encoding data model: %w", err))
+			sendErrorResponse(w, r, fmt.Errorf("error encoding data model: %w", err))
 		}
 
 	case http.MethodPost:
-		body, err := io.ReadAll(r.Body)
+		body, err := readBody(r)
 		if err != nil {
-			sendErrorResponse(w, fmt.Errorf("error reading request body: %w", err))
+			sendErrorResponse(w, r, err)
 			return
 		}
-		defer r.Body.Close()
 
-		var dataModel DataModel
-		if err := json.Unmarshal(body, &dataModel); err != nil {
-			sendErrorResponse(w, fmt.Errorf("error parsing JSON into DataModel: %w", err))
+		dataModel := NewDataModel()
+		if err := json.Unmarshal(body, dataModel); err != nil {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "error parsing JSON into DataModel: %w", err))
 			return
 		}
 
-		if err := SaveDataModel(dataModel); err != nil {
-			sendErrorResponse(w, fmt.Errorf("error saving data model: %w", err))
+		if err := s.replaceDataModel(dataModel, httpSource(r)); err != nil {
+			sendErrorResponse(w, r, err)
 			return
 		}
 
-		// Update server's data model
-		s.dataModel = dataModel
-
 		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
 
 	default:
-		sendErrorResponse(w, fmt.Errorf("method %s not supported", r.Method))
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+	}
+}
+
+// replaceDataModel checks a new data model, saves it to the config file and replaces the server's with it,
+// recording the change as made by the source. The caller must hold the lock.
+func (s *Server) replaceDataModel(dataModel *DataModel, source ChangeSource) error {
+	// Check the new authentication before saving anything, so that a mistake can't lock everyone out
+	authenticator, err := NewAuthenticator(dataModel.Auth)
+	if err != nil {
+		return err
+	}
+	if _, err := dataModel.Server.tlsConfig(); err != nil {
+		return err
 	}
+	cors, err := dataModel.Server.corsPolicy()
+	if err != nil {
+		return err
+	}
+	limits, err := dataModel.Server.limiter()
+	if err != nil {
+		return err
+	}
+	if err := validateAuditConfig(dataModel.Audit); err != nil {
+		return err
+	}
+	if _, err := parseTtlRules(dataModel.Ttl); err != nil {
+		return err
+	}
+	if _, _, err := parseHistoryConfig(dataModel.History); err != nil {
+		return err
+	}
+
+	if err := SaveDataModel(*dataModel); err != nil {
+		return fmt.Errorf("error saving data model: %w", err)
+	}
+
+	// The change is recorded in the audit log in use before it, so that disabling the log is recorded too
+	s.dataModel.audit.record(AuditEntry{Time: time.Now(), Action: "config",
+		Sections: configSections(&s.dataModel, dataModel), Source: source})
+
+	// Update server's data model, keeping its lock, versions, metadata, history and audit log and restarting its schedules
+	dataModel.mu = s.mu
+	dataModel.versions = s.dataModel.versions
+	dataModel.versions.reset()
+	dataModel.metadata = s.dataModel.metadata
+	dataModel.metadata.reset()
+	dataModel.history = s.dataModel.history
+	if err := dataModel.history.configure(dataModel.History); err != nil {
+		log.Printf("Error configuring history: %v", err)
+	}
+	dataModel.audit = s.dataModel.audit
+	if err := dataModel.audit.configure(dataModel.Audit); err != nil {
+		log.Printf("Error configuring audit log: %v", err)
+	}
+	s.scheduler.Stop()
+	s.dataModel = *dataModel
+	s.scheduler.Start()
+	s.auth.Store(authenticator)
+	s.cors.Store(cors)
+	s.limits.Store(limits)
+
+	return nil
 }
 
 func main() {
@@ -201,17 +395,52 @@ func main() {
 	}
 
 	server := CreateServer(dataModel)
+	if err := server.configureAuth(dataModel.Auth); err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	cors, err := dataModel.Server.corsPolicy()
+	if err != nil {
+		log.Fatalf("Failed to configure CORS: %v", err)
+	}
+	server.cors.Store(cors)
+	limits, err := dataModel.Server.limiter()
+	if err != nil {
+		log.Fatalf("Failed to configure limits: %v", err)
+	}
+	server.limits.Store(limits)
+	if err := dataModel.audit.configure(dataModel.Audit); err != nil {
+		log.Fatalf("Failed to configure audit log: %v", err)
+	}
+	if _, err := parseTtlRules(dataModel.Ttl); err != nil {
+		log.Fatalf("Failed to configure TTL rules: %v", err)
+	}
+	if err := dataModel.history.configure(dataModel.History); err != nil {
+		log.Fatalf("Failed to configure history: %v", err)
+	}
 
-	http.HandleFunc("/model", server.ModelHandler)
-	http.HandleFunc("/model/", server.ModelHandler)
-	http.HandleFunc("/node", server.NodeHandler)
-	http.HandleFunc("/node/", server.NodeHandler)
-	http.HandleFunc("/config", server.ConfigHandler)
-	http.HandleFunc("/config/", server.ConfigHandler)
-
-	port := ":8080"
-	fmt.Printf("Server starting on port %s...\n", port[1:])
-	if err := http.ListenAndServe(port, nil); err != nil {
+	server.mu.Lock()
+	server.scheduler.Start()
+	server.mu.Unlock()
+
+	http.HandleFunc("/model", server.authenticated(modelRole, server.watchable(server.synchronized(server.ModelHandler))))
+	http.HandleFunc("/model/", server.authenticated(modelRole, server.watchable(server.synchronized(server.ModelHandler))))
+	http.HandleFunc("/node", server.authenticated(modelRole, server.synchronized(server.NodeHandler)))
+	http.HandleFunc("/node/", server.authenticated(modelRole, server.synchronized(server.NodeHandler)))
+	http.HandleFunc("/config", server.authenticated(adminRole, server.synchronized(server.ConfigHandler)))
+	http.HandleFunc("/config/", server.authenticated(adminRole, server.synchronized(server.ConfigHandler)))
+	http.HandleFunc("/transformations", server.authenticated(adminRole, server.synchronized(server.TransformationsHandler)))
+	http.HandleFunc("/transformations/", server.authenticated(adminRole, server.synchronized(server.TransformationsHandler)))
+	http.HandleFunc("/diagnostics", server.authenticated(adminRole, server.synchronized(server.DiagnosticsHandler)))
+	http.HandleFunc("/diagnostics/", server.authenticated(adminRole, server.synchronized(server.DiagnosticsHandler)))
+	http.HandleFunc("/nodes", server.authenticated(adminRole, server.synchronized(server.NodesHandler)))
+	http.HandleFunc("/nodes/", server.authenticated(adminRole, server.synchronized(server.NodesHandler)))
+	http.HandleFunc("/batch", server.authenticated(batchRole, server.synchronized(server.BatchHandler)))
+	http.HandleFunc("/history/", server.authenticated(modelRole, server.synchronized(server.HistoryHandler)))
+	http.HandleFunc("/audit", server.authenticated(adminRole, server.AuditHandler))
+	http.HandleFunc("/snapshots", server.authenticated(adminRole, server.synchronized(server.SnapshotsHandler)))
+	http.HandleFunc("/snapshots/", server.authenticated(adminRole, server.synchronized(server.SnapshotsHandler)))
+
+	if err := ListenAndServe(dataModel.Server, server.withCors(server.limited(http.DefaultServeMux))); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEtagListMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		want   bool
+	}{
+		{`"42"`, `"42"`, true},
+		{`"41"`, `"42"`, false},
+		{`"41", "42"`, `"42"`, true},
+		{`"41","43"`, `"42"`, false},
+		{`W/"42"`, `"42"`, true},
+		{` W/"41" , W/"42" `, `"42"`, true},
+		{`*`, `"42"`, true},
+		{`42`, `"42"`, false},
+		{``, `"42"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagListMatches(tt.header, tt.etag); got != tt.want {
+			t.Errorf("etagListMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestIsNotModified(t *testing.T) {
+	modified := time.Date(2026, 3, 14, 2, 14, 7, 510000000, time.UTC)
+	version := ModelVersion{Version: 42, Modified: modified}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no conditions", nil, false},
+		{"matching If-None-Match", map[string]string{"If-None-Match": `"42"`}, true},
+		{"older If-None-Match", map[string]string{"If-None-Match": `"41"`}, false},
+		{"If-Modified-Since the same second", map[string]string{"If-Modified-Since": "Sat, 14 Mar 2026 02:14:07 GMT"}, true},
+		{"If-Modified-Since later", map[string]string{"If-Modified-Since": "Sat, 14 Mar 2026 03:00:00 GMT"}, true},
+		{"If-Modified-Since earlier", map[string]string{"If-Modified-Since": "Sat, 14 Mar 2026 02:14:06 GMT"}, false},
+		{"invalid If-Modified-Since", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"If-None-Match takes precedence", map[string]string{
+			"If-None-Match":     `"41"`,
+			"If-Modified-Since": "Sat, 14 Mar 2026 03:00:00 GMT",
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/model", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := isNotModified(r, version); got != tt.want {
+				t.Errorf("isNotModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	version := ModelVersion{Version: 42, Modified: time.Now()}
+
+	tests := []struct {
+		ifMatch string
+		wantErr bool
+	}{
+		{"", false},
+		{`"42"`, false},
+		{`"41", "42"`, false},
+		{`*`, false},
+		{`"41"`, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/model", nil)
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+		err := checkIfMatch(r, version)
+		if tt.wantErr && !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("checkIfMatch(%q) error = %v, want precondition_failed", tt.ifMatch, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("checkIfMatch(%q) error = %v, want nil", tt.ifMatch, err)
+		}
+	}
+}
+
+func TestModelHandlerRejectsValues(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"temp": {"c": 20}}, "transformations": {
+		"temp/c": {"onWrite": "if (typeof self !== 'number') throw new Error('expected a number'); (self - 32) * 5 / 9"}}}`)
+	server := CreateServer(*dataModel)
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantCode   string
+		wantValue  float64
+	}{
+		{`"warm"`, http.StatusUnprocessableEntity, "value_rejected", 20},
+		{`{"c": "warm"}`, http.StatusUnprocessableEntity, "value_rejected", 20},
+		{`212`, http.StatusOK, "", 100},
+	}
+
+	for _, tt := range tests {
+		target := "/model/temp/c"
+		if strings.HasPrefix(tt.body, "{") {
+			target = "/model/temp"
+		}
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ModelHandler(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("POST %s status = %d, want %d: %s", tt.body, w.Code, tt.wantStatus, w.Body)
+		}
+		if tt.wantCode != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.wantCode+`"`) {
+			t.Errorf("POST %s response = %s, want code %s", tt.body, w.Body, tt.wantCode)
+		}
+		if value, _ := LookupPath(server.dataModel.Model, []string{"temp", "c"}); value != tt.wantValue {
+			t.Errorf("after POST %s temp/c = %v, want %v", tt.body, value, tt.wantValue)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Qualities of values in the model
+const (
+	QualityGood  = "good"  // The value is current and trustworthy
+	QualityStale = "stale" // The value hasn't been updated for too long
+	QualityBad   = "bad"   // The writer reported the value as unreliable
+)
+
+// ValueMetadata describes when and where a value in the model came from
+type ValueMetadata struct {
+	Updated time.Time `json:"updated"` // When the value was last written
+	Source  string    `json:"source"`  // Kind of source that wrote it: "http", "node", "mqtt", "schedule", "script" or "config"
+	Quality string    `json:"quality"` // "good", "stale" or "bad"
+}
+
+// ValueWithMetadata is the response to a read with ?meta=true
+type ValueWithMetadata struct {
+	Value any                      `json:"value"`
+	Meta  map[string]ValueMetadata `json:"meta"` // key: path of a value beneath the read path, value: its metadata
+}
+
+// validateQuality checks a quality reported by a writer, which is good if empty
+func validateQuality(quality string) error {
+	switch quality {
+	case "", QualityGood, QualityStale, QualityBad:
+		return nil
+	default:
+		return newError(ErrBadRequest, "invalid quality '%s', expected 'good', 'stale' or 'bad'", quality)
+	}
+}
+
+// metadataStore keeps the metadata of the leaf values written to the model, which are those that aren't objects.
+// Like the model, it must only be used while holding the lock.
+type metadataStore struct {
+	values map[string]ValueMetadata // key: path of a leaf value
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{values: make(map[string]ValueMetadata)}
+}
+
+// reset forgets all metadata, when the model is replaced
+func (m *metadataStore) reset() {
+	m.values = make(map[string]ValueMetadata)
+}
+
+// forget removes the metadata of the value replaced at the path: of the path itself, of the paths beneath it
+// if the value was an object, and of any parent that was a leaf before objects were created beneath it
+func (m *metadataStore) forget(path string, oldValue any) {
+	if path == "" {
+		m.reset()
+		return
+	}
+
+	delete(m.values, path)
+	for i := strings.LastIndex(path, "/"); i > 0; i = strings.LastIndex(path[:i], "/") {
+		delete(m.values, path[:i])
+	}
+
+	if _, ok := oldValue.(map[string]any); ok {
+		for leafPath := range m.values {
+			if strings.HasPrefix(leafPath, path+"/") {
+				delete(m.values, leafPath)
+			}
+		}
+	}
+}
+
+// record replaces the metadata of the value at the path, giving each of the new value's leaves the metadata
+func (m *metadataStore) record(path string, oldValue, value any, metadata ValueMetadata) {
+	m.forget(path, oldValue)
+	WalkLeaves(path, value, func(leafPath string, _ any) {
+		m.values[leafPath] = metadata
+	})
+}
+
+// get returns the metadata of a leaf value
+func (m *metadataStore) get(path string) (ValueMetadata, bool) {
+	metadata, ok := m.values[path]
+	return metadata, ok
+}
+
+// beneath returns the metadata of the leaf values at or beneath the path
+func (m *metadataStore) beneath(path string) map[string]ValueMetadata {
+	result := make(map[string]ValueMetadata)
+	for leafPath, metadata := range m.values {
+		if isSubPath(leafPath, path) {
+			result[leafPath] = metadata
+		}
+	}
+	return result
+}
+
+// newValueMetadata describes a value written now by the source
+func newValueMetadata(source ChangeSource) ValueMetadata {
+	metadata := ValueMetadata{Updated: time.Now(), Source: source.Kind, Quality: source.Quality}
+	if source.Node != "" {
+		metadata.Source = "node"
+	}
+	if metadata.Quality == "" {
+		metadata.Quality = QualityGood
+	}
+	return metadata
+}
+
+// ReadableMetadata returns the metadata of the values at or beneath the path that the access policy allows reading
+func (d *DataModel) ReadableMetadata(path string, policy *AccessPolicy) map[string]ValueMetadata {
+	metadata := d.metadata.beneath(path)
+	for leafPath := range metadata {
+		if !policy.Allows(http.MethodGet, "/model/"+leafPath) {
+			delete(metadata, leafPath)
+		}
+	}
+	return metadata
+}
+
+// scriptMetadata converts metadata into the plain JSON types scripts work with
+func scriptMetadata(metadata ValueMetadata) map[string]any {
+	return map[string]any{
+		"updated": metadata.Updated.UTC().Format(time.RFC3339Nano),
+		"source":  metadata.Source,
+		"quality": metadata.Quality,
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// metadataSummary describes the metadata of the leaves as "path:source:quality" entries, sorted by path
+func metadataSummary(metadata map[string]ValueMetadata) string {
+	var entries []string
+	for path, value := range metadata {
+		entries = append(entries, path+":"+value.Source+":"+value.Quality)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+func TestMetadataFollowsWrites(t *testing.T) {
+	httpWrite := ChangeSource{Kind: SourceHTTP}
+	mqttWrite := ChangeSource{Kind: SourceMqtt, Quality: QualityBad}
+	nodeWrite := ChangeSource{Kind: SourceHTTP, Node: "line"}
+
+	type write struct {
+		path   string
+		value  any // Deletes the path if nil
+		source ChangeSource
+	}
+	tests := []struct {
+		name   string
+		writes []write
+		want   string
+	}{
+		{"set leaf", []write{{"line/speed", 3.0, httpWrite}},
+			"line/speed:http:good"},
+		{"set object", []write{{"line", map[string]any{"speed": 3.0, "motor": map[string]any{"temp": 40.0}}, mqttWrite}},
+			"line/motor/temp:mqtt:bad line/speed:mqtt:bad"},
+		{"set through a node", []write{{"line/speed", 3.0, nodeWrite}},
+			"line/speed:node:good"},
+		{"overwrite keeps siblings", []write{
+			{"line", map[string]any{"speed": 3.0, "mode": "fast"}, httpWrite},
+			{"line/speed", 4.0, mqttWrite}},
+			"line/mode:http:good line/speed:mqtt:bad"},
+		{"object replaced by leaf", []write{
+			{"line", map[string]any{"speed": 3.0, "mode": "fast"}, httpWrite},
+			{"line", 0.0, mqttWrite}},
+			"line:mqtt:bad"},
+		{"leaf replaced by object", []write{
+			{"line", 0.0, httpWrite},
+			{"line/speed", 3.0, mqttWrite}},
+			"line/speed:mqtt:bad"},
+		{"delete leaf", []write{
+			{"line", map[string]any{"speed": 3.0, "mode": "fast"}, httpWrite},
+			{"line/speed", nil, httpWrite}},
+			"line/mode:http:good"},
+		{"delete subtree", []write{
+			{"line", map[string]any{"speed": 3.0, "motor": map[string]any{"temp": 40.0}}, httpWrite},
+			{"other", 1.0, mqttWrite},
+			{"line", nil, httpWrite}},
+			"other:mqtt:bad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, `{"model": {}}`)
+			for _, w := range tt.writes {
+				pathTokens := strings.Split(w.path, "/")
+				var err error
+				if w.value == nil {
+					err = dataModel.deleteModelData(pathTokens, w.source)
+				} else {
+					err = dataModel.SetModelData(pathTokens, w.value, w.source)
+				}
+				if err != nil {
+					t.Fatalf("writing %s error = %v", w.path, err)
+				}
+			}
+
+			if got := metadataSummary(dataModel.metadata.beneath("")); got != tt.want {
+				t.Errorf("metadata = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadableMetadata(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {}}`)
+	value := map[string]any{"setpoints": map[string]any{"a": 1.0, "b": 2.0}, "erp": map[string]any{"secret": 3.0}}
+	if err := dataModel.SetModelData([]string{"plant"}, value, ChangeSource{Kind: SourceHTTP}); err != nil {
+		t.Fatalf("SetModelData error = %v", err)
+	}
+	policy := newAccessPolicy([]AclRule{
+		{Roles: []string{"operator"}, Methods: []string{http.MethodGet}, Paths: []string{"/model/plant/setpoints/**"}},
+	}, &Principal{Name: "panel", Roles: []string{"operator"}})
+
+	tests := []struct {
+		name   string
+		path   string
+		policy *AccessPolicy
+		want   []string
+	}{
+		{"no ACL", "plant", nil, []string{"plant/erp/secret", "plant/setpoints/a", "plant/setpoints/b"}},
+		{"hidden entries dropped", "plant", policy, []string{"plant/setpoints/a", "plant/setpoints/b"}},
+		{"readable subtree", "plant/setpoints", policy, []string{"plant/setpoints/a", "plant/setpoints/b"}},
+		{"hidden subtree", "plant/erp", policy, []string{}},
+	}
+
+	for _, tt := range tests {
+		paths := []string{}
+		for path := range dataModel.ReadableMetadata(tt.path, tt.policy) {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		got, _ := json.Marshal(paths)
+		want, _ := json.Marshal(tt.want)
+		if string(got) != string(want) {
+			t.Errorf("%s: ReadableMetadata(%q) paths = %s, want %s", tt.name, tt.path, got, want)
+		}
+	}
+}
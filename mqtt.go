@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
@@ -102,7 +103,7 @@ func (m *MqttClient) Connect() {
 	}
 }
 
-func (m *MqttClient) SetupSubscriptions(setModelDataCallback func([]string, any, bool) error) {
+func (m *MqttClient) SetupSubscriptions(setModelDataCallback func([]string, any, ChangeSource) error) {
 	// Initialize the callbacks map if it doesn't exist
 	if m.callbacks == nil {
 		m.callbacks = make(map[string]mqtt.MessageHandler)
@@ -138,7 +139,7 @@ func (m *MqttClient) SetupSubscriptions(setModelDataCallback func([]string, any,
 				}
 
 				// Call the setModelDataCallback with path segments and unmarshaled data
-				err = setModelDataCallback(localPathTokens, data, true)
+				err = setModelDataCallback(localPathTokens, data, ChangeSource{Kind: SourceMqtt, Topic: msg.Topic()})
 				if err != nil {
 					log.Printf("Error in setModelDataCallback for topic %s: %v", msg.Topic(), err)
 				} else {
@@ -167,16 +168,28 @@ func (m *MqttClient) Disconnect() {
 
 // Publish a message to a specified JSON path and trigger any associated publishes
 func (m *MqttClient) PublishMessage(pathTokens []string, getModelDataCallback func([]string, bool) (any, error)) error {
-	fullPath := strings.Join(pathTokens, "/")
+	return m.PublishMappings(m.AffectedMappings(strings.Join(pathTokens, "/")), getModelDataCallback)
+}
+
+// AffectedMappings returns the mapped paths whose payload changes when the path changes: the path and its parents
+func (m *MqttClient) AffectedMappings(fullPath string) []string {
+	var paths []string
+	for path := range m.Paths {
+		if isSubPath(fullPath, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// PublishMappings publishes the current values of the mapped paths to their topics
+func (m *MqttClient) PublishMappings(paths []string, getModelDataCallback func([]string, bool) (any, error)) error {
 	var err error
 	var tokens []mqtt.Token
 
 	// Publish to all matching mqtt paths
-	for path, mqttPaths := range m.Paths {
-		if !strings.HasPrefix(fullPath, path) {
-			continue
-		}
-
+	for _, path := range paths {
 		// We need to get the payload for this path, even if it was triggered by a field deeper within the object.
 		payloadObj, err := getModelDataCallback(strings.Split(path, "/"), false)
 		if err != nil {
@@ -188,7 +201,7 @@ func (m *MqttClient) PublishMessage(pathTokens []string, getModelDataCallback fu
 			return err
 		}
 
-		for _, mqttPath := range mqttPaths {
+		for _, mqttPath := range m.Paths[path] {
 			if mqttPath.PublishType == Pub || mqttPath.PublishType == PubSub {
 				token := m.Client.Publish(mqttPath.Topic, byte(mqttPath.Qos), mqttPath.Retain, payload)
 				log.Printf("Published payload to topic \"%s\": %s", mqttPath.Topic, string(payload))
@@ -209,6 +222,22 @@ func (m *MqttClient) PublishMessage(pathTokens []string, getModelDataCallback fu
 	return err
 }
 
+// Publish sends a payload to a single topic, independently of the path mappings
+func (m *MqttClient) Publish(topic string, payload []byte) error {
+	if m.Client == nil || !m.Client.IsConnected() {
+		return fmt.Errorf("MQTT client is not connected")
+	}
+
+	token := m.Client.Publish(topic, byte(AtMostOnce), false, payload)
+	token.Wait()
+	if token.Error() != nil {
+		return fmt.Errorf("Error publishing: %v", token.Error())
+	}
+
+	log.Printf("Published payload to topic \"%s\": %s", topic, string(payload))
+	return nil
+}
+
 // Create a new TLS configuration for secure MQTT connections
 func newTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
 	// Load CA certificate
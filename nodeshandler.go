@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NodesHandler handles requests to the nodes endpoint, which manages the node configuration
+func (s *Server) NodesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	name := strings.Join(extractPathTokens(r.URL.Path, "/nodes"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			sendJSONResponse(w, s.dataModel.Nodes, http.StatusOK)
+			return
+		}
+
+		paths, exists := s.dataModel.Nodes[name]
+		if !exists {
+			sendErrorResponse(w, r, newError(ErrNotFound, "node '%s' not found", name))
+			return
+		}
+
+		sendJSONResponse(w, paths, http.StatusOK)
+
+	case http.MethodPut:
+		jsonData, err := readJSONBody(w, r)
+		if err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		items, ok := jsonData.([]any)
+		if !ok {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid JSON format: expected an array of paths"))
+			return
+		}
+
+		paths := make([]string, 0, len(items))
+		for _, item := range items {
+			path, ok := item.(string)
+			if !ok {
+				sendErrorResponse(w, r, newError(ErrBadRequest, "invalid JSON format: expected an array of paths"))
+				return
+			}
+			paths = append(paths, path)
+		}
+
+		oldPaths, existed := s.dataModel.Nodes[name]
+		if err := s.dataModel.SetNode(name, paths); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		entry := AuditEntry{Time: time.Now(), Action: "config", Sections: []string{"nodes"},
+			Path: name, NewValue: paths, Source: httpSource(r)}
+		if existed {
+			entry.OldValue = oldPaths
+		}
+		s.dataModel.audit.record(entry)
+
+		if err := s.persistIfRequested(r); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+
+	case http.MethodDelete:
+		oldPaths := s.dataModel.Nodes[name]
+		if err := s.dataModel.DeleteNode(name); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		s.dataModel.audit.record(AuditEntry{Time: time.Now(), Action: "config", Sections: []string{"nodes"},
+			Path: name, OldValue: oldPaths, Source: httpSource(r)})
+
+		if err := s.persistIfRequested(r); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+
+	default:
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// QueryOptions narrows down the data returned by a read
+type QueryOptions struct {
+	Query  *jmespath.JMESPath // JMESPath expression selecting from the data, or nil
+	Fields [][]string         // Paths of the fields to keep, relative to the data, or nil for all fields
+	Depth  int                // Number of levels of nested objects and arrays to include, or -1 for all
+	Meta   bool               // Whether to return the metadata of the values along with the data
+}
+
+// parseQueryOptions reads the "q", "fields", "depth" and "meta" query parameters
+func parseQueryOptions(query url.Values) (QueryOptions, error) {
+	options := QueryOptions{Depth: -1}
+
+	if expression := query.Get("q"); expression != "" {
+		compiled, err := jmespath.Compile(expression)
+		if err != nil {
+			return options, newError(ErrBadRequest, "invalid query parameter 'q': %s", err.Error())
+		}
+		options.Query = compiled
+	}
+
+	if fields := query.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.Trim(strings.TrimSpace(field), "/")
+			if err := validateModelPath(field); err != nil {
+				return options, newError(ErrBadRequest, "invalid query parameter 'fields': %s", err.Error())
+			}
+			options.Fields = append(options.Fields, strings.Split(field, "/"))
+		}
+	}
+
+	if depth := query.Get("depth"); depth != "" {
+		value, err := strconv.Atoi(depth)
+		if err != nil || value < 0 {
+			return options, newError(ErrBadRequest, "invalid query parameter 'depth': '%s' is not a non-negative integer", depth)
+		}
+		options.Depth = value
+	}
+
+	options.Meta = query.Get("meta") == "true"
+
+	return options, nil
+}
+
+// apply narrows down the data: selecting with the query, then keeping the fields, then limiting the depth
+func (options QueryOptions) apply(data any) (any, error) {
+	if options.Query != nil {
+		var err error
+		if data, err = options.Query.Search(data); err != nil {
+			return nil, newError(ErrBadRequest, "invalid query: %s", err.Error())
+		}
+	}
+
+	if options.Fields != nil {
+		data = projectFields(data, options.Fields)
+	}
+
+	if options.Depth >= 0 {
+		data = limitDepth(data, options.Depth)
+	}
+
+	return data, nil
+}
+
+// projectFields returns the data with only the given fields of its objects. Fields of the objects in arrays are
+// kept for each element, so that "lines/speed" keeps the speed of every line when "lines" is an array.
+func projectFields(data any, fields [][]string) any {
+	switch value := data.(type) {
+	case []any:
+		result := make([]any, len(value))
+		for i, item := range value {
+			result[i] = projectFields(item, fields)
+		}
+		return result
+
+	case map[string]any:
+		// Group the fields by their first element
+		nestedFields := make(map[string][][]string)
+		for _, field := range fields {
+			if len(field) == 0 {
+				return value // The whole object is kept
+			}
+			nestedFields[field[0]] = append(nestedFields[field[0]], field[1:])
+		}
+
+		result := make(map[string]any)
+		for key, nested := range nestedFields {
+			if child, exists := value[key]; exists {
+				result[key] = projectFields(child, nested)
+			}
+		}
+		return result
+
+	default:
+		return data
+	}
+}
+
+// limitDepth returns the data with objects and arrays nested more than depth levels deep replaced by empty ones
+func limitDepth(data any, depth int) any {
+	switch value := data.(type) {
+	case []any:
+		result := make([]any, 0, len(value))
+		if depth > 0 {
+			for _, item := range value {
+				result = append(result, limitDepth(item, depth-1))
+			}
+		}
+		return result
+
+	case map[string]any:
+		result := make(map[string]any)
+		if depth > 0 {
+			for key, child := range value {
+				result[key] = limitDepth(child, depth-1)
+			}
+		}
+		return result
+
+	default:
+		return data
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseQueryOptions(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantErr   bool
+		wantDepth int
+	}{
+		{"", false, -1},
+		{"q=lines[?speed>`2`].name", false, -1},
+		{"q=lines[?speed>", true, -1},
+		{"q=" + url.QueryEscape("foo bar"), true, -1},
+		{"fields=" + url.QueryEscape("a, b/c, /d/"), false, -1},
+		{"fields=" + url.QueryEscape("a,,b"), true, -1},
+		{"fields=" + url.QueryEscape("a//b"), true, -1},
+		{"depth=0", false, 0},
+		{"depth=2", false, 2},
+		{"depth=-1", true, -1},
+		{"depth=two", true, -1},
+		{"depth=1.5", true, -1},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		options, err := parseQueryOptions(query)
+		if tt.wantErr {
+			if !errors.Is(err, ErrBadRequest) {
+				t.Errorf("parseQueryOptions(%q) error = %v, want bad_request", tt.query, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQueryOptions(%q) error = %v", tt.query, err)
+			continue
+		}
+		if options.Depth != tt.wantDepth {
+			t.Errorf("parseQueryOptions(%q) depth = %d, want %d", tt.query, options.Depth, tt.wantDepth)
+		}
+	}
+}
+
+func TestQueryOptionsApply(t *testing.T) {
+	data := `{"site": "north", "lines": [{"name": "a", "speed": 3, "motor": {"temp": 40}}, {"name": "b", "speed": 1}],
+		"alarms": {"count": 2, "last": {"code": 7}}}`
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"no options", "", `{"alarms":{"count":2,"last":{"code":7}},"lines":[{"motor":{"temp":40},"name":"a","speed":3},{"name":"b","speed":1}],"site":"north"}`, false},
+		{"query", "q=lines[?speed>`2`].name", `["a"]`, false},
+		{"query without match", "q=missing", `null`, false},
+		{"query type error", "q=" + url.QueryEscape("abs(site)"), ``, true},
+		{"fields of an object", "fields=site,alarms/count", `{"alarms":{"count":2},"site":"north"}`, false},
+		{"fields of arrays of objects", "fields=lines/name", `{"lines":[{"name":"a"},{"name":"b"}]}`, false},
+		{"nested fields in arrays", "fields=lines/motor/temp", `{"lines":[{"motor":{"temp":40}},{}]}`, false},
+		{"missing field", "fields=missing", `{}`, false},
+		{"whole object and part of it", "fields=alarms,alarms/count", `{"alarms":{"count":2,"last":{"code":7}}}`, false},
+		{"depth 0", "depth=0", `{}`, false},
+		{"depth 1", "depth=1", `{"alarms":{},"lines":[],"site":"north"}`, false},
+		{"depth 2", "depth=2", `{"alarms":{"count":2,"last":{}},"lines":[{},{}],"site":"north"}`, false},
+		{"query then fields", "q=lines&fields=speed", `[{"speed":3},{"speed":1}]`, false},
+		{"fields then depth", "fields=lines&depth=2", `{"lines":[{},{}]}`, false},
+		{"query, fields and depth", "q=lines[0]&fields=motor,name&depth=1", `{"motor":{},"name":"a"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			json.Unmarshal([]byte(data), &value)
+
+			query, _ := url.ParseQuery(tt.query)
+			options, err := parseQueryOptions(query)
+			if err != nil {
+				t.Fatalf("parseQueryOptions(%q) error = %v", tt.query, err)
+			}
+
+			got, err := options.apply(value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBadRequest) {
+					t.Fatalf("apply() error = %v, want bad_request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			gotJson, _ := json.Marshal(got)
+			if string(gotJson) != tt.want {
+				t.Errorf("apply() = %s, want %s", gotJson, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelHandlerQueryOptions(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"line": {"speed": 3, "motor": {"temp": 40}}}, "transformations": {
+		"line/speed": {"implementation": "self * 10"}}}`)
+	server := CreateServer(*dataModel)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       string
+	}{
+		{"/model/line?fields=speed", http.StatusOK, `{"speed":30}`},
+		{"/model/line?fields=speed&raw=y", http.StatusOK, `{"speed":3}`},
+		{"/model/line?q=speed&raw=y", http.StatusOK, `3`},
+		{"/model/line?depth=1&raw=y", http.StatusOK, `{"motor":{},"speed":3}`},
+		{"/model/line?depth=1", http.StatusOK, `{"motor":{},"speed":30}`},
+		{"/model/line?q=" + url.QueryEscape("[speed, motor.temp]"), http.StatusOK, `[30,40]`},
+		{"/model/line?q=speed[", http.StatusBadRequest, ``},
+		{"/model/line?depth=-1&raw=y", http.StatusBadRequest, ``},
+		{"/model/line?depth=deep", http.StatusBadRequest, ``},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		server.ModelHandler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s status = %d, want %d: %s", tt.target, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var got any
+		json.Unmarshal(w.Body.Bytes(), &got)
+		gotJson, _ := json.Marshal(got)
+		if string(gotJson) != tt.want {
+			t.Errorf("GET %s = %s, want %s", tt.target, gotJson, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser accepts standard 5-field cron expressions, an optional leading seconds field, and descriptors like @hourly
+var scheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// parseSchedule parses a transformation's schedule, which is either an interval such as "10s" or a cron expression
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	if interval, err := time.ParseDuration(schedule); err == nil {
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval '%s' must be positive", schedule)
+		}
+		return cron.Every(interval), nil
+	}
+
+	return scheduleParser.Parse(schedule)
+}
+
+// Scheduler periodically evaluates transformations that have a schedule and stores their results in the model
+type Scheduler struct {
+	dataModel *DataModel
+	stop      chan struct{}
+}
+
+// NewScheduler creates a scheduler for the transformations of a data model
+func NewScheduler(dataModel *DataModel) *Scheduler {
+	return &Scheduler{dataModel: dataModel}
+}
+
+// Start begins running the scheduled transformations, and checking for stale values if there are TTL rules.
+// The data model's lock must be held.
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+
+	if rules, err := parseTtlRules(s.dataModel.Ttl); err != nil {
+		log.Printf("Not checking for stale values: %v", err)
+	} else if len(rules) > 0 {
+		s.dataModel.startTtlClocks(rules)
+		go s.expireStaleValues(rules, s.stop)
+	}
+
+	for path := range s.dataModel.Transformations {
+		transformation, err := s.dataModel.getTransformation(path)
+		if err != nil || transformation.Schedule == "" {
+			continue
+		}
+
+		schedule, err := parseSchedule(transformation.Schedule)
+		if err != nil {
+			log.Printf("Invalid schedule for transformation '%s': %v", path, err)
+			continue
+		}
+
+		go s.run(path, schedule, s.stop)
+		log.Printf("Transformation '%s' is scheduled with \"%s\"", path, transformation.Schedule)
+	}
+}
+
+// Stop stops running the scheduled transformations. It doesn't wait for evaluations in progress.
+func (s *Scheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Restart picks up changes to the scheduled transformations. The data model's lock must be held.
+func (s *Scheduler) Restart() {
+	s.Stop()
+	s.Start()
+}
+
+// expireStaleValues periodically checks the values for exceeding their maximum age, until stop is closed
+func (s *Scheduler) expireStaleValues(rules []ttlRule, stop chan struct{}) {
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.dataModel.mu.Lock()
+			select {
+			case <-stop:
+				// The configuration changed while waiting for the lock
+				s.dataModel.mu.Unlock()
+				return
+			default:
+			}
+
+			if err := s.dataModel.expireStaleValues(rules, now); err != nil {
+				log.Printf("Error expiring stale values: %v", err)
+			}
+			s.dataModel.mu.Unlock()
+		}
+	}
+}
+
+// run evaluates a transformation each time its schedule fires, until stop is closed
+func (s *Scheduler) run(path string, schedule cron.Schedule, stop chan struct{}) {
+	for {
+		timer := time.NewTimer(time.Until(schedule.Next(time.Now())))
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.dataModel.mu.Lock()
+		select {
+		case <-stop:
+			// The schedule changed while waiting for the lock
+			s.dataModel.mu.Unlock()
+			return
+		default:
+		}
+
+		if err := s.dataModel.runScheduledTransformation(path); err != nil {
+			log.Printf("Scheduled transformation '%s' failed: %v", path, err)
+		}
+		s.dataModel.mu.Unlock()
+	}
+}
+
+// runScheduledTransformation evaluates a scheduled transformation with its stored value as "self",
+// and stores the result in the model, publishing it over MQTT as with any other change
+func (d *DataModel) runScheduledTransformation(path string) error {
+	transformation, err := d.getTransformation(path)
+	if err != nil {
+		return err
+	}
+	if transformation == nil {
+		return fmt.Errorf("transformation '%s' not found", path)
+	}
+
+	pathTokens := strings.Split(path, "/")
+	selfValue, err := d.selfValue(path)
+	if err != nil {
+		return err
+	}
+
+	result, err := d.runScript(path, transformation, transformation.Implementation, selfValue)
+	if err != nil {
+		return err
+	}
+
+	return d.SetModelData(pathTokens, result, ChangeSource{Kind: SourceSchedule, Transformation: path})
+}
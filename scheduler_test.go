@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2026, 3, 14, 5, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		schedule string
+		wantNext time.Duration // Time from start to the first run
+		wantErr  bool
+	}{
+		{"10s", 10 * time.Second, false},
+		{"5m", 5 * time.Minute, false},
+		{"1s", time.Second, false},
+		{"500ms", time.Second, false},  // Intervals are at least a second
+		{"1500ms", time.Second, false}, // and whole seconds
+		{"0 6 * * *", time.Hour, false},
+		{"*/10 * * * * *", 10 * time.Second, false},
+		{"@hourly", time.Hour, false},
+		{"0s", 0, true},
+		{"-1m", 0, true},
+		{"", 0, true},
+		{"every minute", 0, true},
+		{"61 * * * *", 0, true},
+		{"* * * *", 0, true},
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseSchedule(tt.schedule)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSchedule(%q) succeeded, want an error", tt.schedule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSchedule(%q) error = %v", tt.schedule, err)
+			continue
+		}
+		if next := schedule.Next(start).Sub(start); next != tt.wantNext {
+			t.Errorf("parseSchedule(%q) first runs after %s, want %s", tt.schedule, next, tt.wantNext)
+		}
+	}
+}
+
+func TestRunScheduledTransformation(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"shift": {"count": 1}}, "transformations": {
+		"shift/count": {"implementation": "self + 1", "schedule": "1h"},
+		"shift/missing": {"implementation": "self === null ? 10 : self * 2", "schedule": "1h"}}}`)
+
+	for i := 0; i < 2; i++ {
+		for _, path := range []string{"shift/count", "shift/missing"} {
+			if err := dataModel.runScheduledTransformation(path); err != nil {
+				t.Fatalf("runScheduledTransformation(%q) error = %v", path, err)
+			}
+		}
+	}
+
+	// Reads return the stored results without running the scripts again
+	tests := []struct {
+		path string
+		want float64
+	}{
+		{"shift/count", 3},
+		{"shift/missing", 20},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 2; i++ {
+			got, err := dataModel.GetModelData(strings.Split(tt.path, "/"), false)
+			if err != nil {
+				t.Fatalf("GetModelData(%q) error = %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetModelData(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		}
+		if stored, _ := LookupPath(dataModel.Model, strings.Split(tt.path, "/")); stored != tt.want {
+			t.Errorf("stored %q = %v, want %v", tt.path, stored, tt.want)
+		}
+		if metadata, _ := dataModel.metadata.get(tt.path); metadata.Source != SourceSchedule {
+			t.Errorf("source of %q = %q, want %q", tt.path, metadata.Source, SourceSchedule)
+		}
+	}
+
+	if err := dataModel.runScheduledTransformation("shift/other"); err == nil {
+		t.Error("runScheduledTransformation of a missing transformation succeeded, want an error")
+	}
+}
+
+func TestSchedulerRunsTransformations(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"heartbeat": 0}, "transformations": {
+		"heartbeat": {"implementation": "self + 1", "schedule": "1s"}}}`)
+	scheduler := NewScheduler(dataModel)
+
+	dataModel.mu.Lock()
+	changed := dataModel.versions.nextChange()
+	scheduler.Start()
+	dataModel.mu.Unlock()
+	defer func() {
+		dataModel.mu.Lock()
+		scheduler.Stop()
+		dataModel.mu.Unlock()
+	}()
+
+	select {
+	case <-changed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("scheduled transformation didn't run")
+	}
+
+	dataModel.mu.Lock()
+	defer dataModel.mu.Unlock()
+	if value := dataModel.Model["heartbeat"]; value != 1.0 {
+		t.Errorf("heartbeat = %v, want 1", value)
+	}
+}
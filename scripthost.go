@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ScriptHost is the API that scripts use to reach beyond their "self" and parameters,
+// available as model.get(path), model.meta(path), model.set(path, value) and mqtt.publish(topic, payload)
+type ScriptHost interface {
+	Get(path string) (any, error)
+	Meta(path string) (any, error)
+	Set(path string, value any) error
+	Publish(topic string, payload any) error
+}
+
+// transformationHost implements ScriptHost for the scripts of the transformation at path,
+// recording the paths it reads so that its cached result can be invalidated when they change
+type transformationHost struct {
+	dataModel   *DataModel
+	path        string
+	allowWrites bool            // Whether model.set and mqtt.publish are permitted
+	testing     bool            // Whether the script is being run by TestTransformation, which has no side effects
+	reads       map[string]bool // Paths read with model.get or model.meta
+}
+
+func newTransformationHost(dataModel *DataModel, path string, transformation *Transformation) *transformationHost {
+	return &transformationHost{
+		dataModel:   dataModel,
+		path:        path,
+		allowWrites: transformation.AllowWrites,
+		reads:       make(map[string]bool),
+	}
+}
+
+// Get reads a path from the model, applying transformations
+func (h *transformationHost) Get(path string) (any, error) {
+	if err := validateModelPath(path); err != nil {
+		return nil, fmt.Errorf("model.get: %w", err)
+	}
+	if isSubPath(h.path, path) {
+		return nil, fmt.Errorf("model.get: path '%s' depends on the transformation itself", path)
+	}
+
+	h.reads[path] = true
+	return h.dataModel.GetModelData(strings.Split(path, "/"), false)
+}
+
+// Meta returns the metadata of a value written to the model, or nil if it has none
+func (h *transformationHost) Meta(path string) (any, error) {
+	if err := validateModelPath(path); err != nil {
+		return nil, fmt.Errorf("model.meta: %w", err)
+	}
+
+	// The metadata only changes along with the value, so the result depends on the path like a read of it
+	h.reads[path] = true
+	metadata, ok := h.dataModel.metadata.get(path)
+	if !ok {
+		return nil, nil
+	}
+	return scriptMetadata(metadata), nil
+}
+
+// Set writes a value to the model, as if it had been POSTed
+func (h *transformationHost) Set(path string, value any) error {
+	if err := h.checkWrite("model.set"); err != nil {
+		return err
+	}
+	if err := validateModelPath(path); err != nil {
+		return fmt.Errorf("model.set: %w", err)
+	}
+
+	return h.dataModel.SetModelData(strings.Split(path, "/"), value, ChangeSource{Kind: SourceScript, Transformation: h.path})
+}
+
+// Publish sends a payload to an MQTT topic. Strings are sent as-is and other values as JSON.
+func (h *transformationHost) Publish(topic string, payload any) error {
+	if err := h.checkWrite("mqtt.publish"); err != nil {
+		return err
+	}
+	if h.dataModel.Mqtt == nil {
+		return fmt.Errorf("mqtt.publish: MQTT is not configured")
+	}
+
+	message, ok := payload.(string)
+	if !ok {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("mqtt.publish: %w", err)
+		}
+		message = string(jsonData)
+	}
+
+	return h.dataModel.Mqtt.Publish(topic, []byte(message))
+}
+
+// checkWrite returns an error if the script isn't permitted to have side effects
+func (h *transformationHost) checkWrite(function string) error {
+	if h.testing {
+		return fmt.Errorf("%s is not available when testing a transformation", function)
+	}
+	if !h.allowWrites {
+		return fmt.Errorf("%s requires \"allowWrites\": true on transformation '%s'", function, h.path)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of differences between data models
+const (
+	ChangeAdded   = "added"   // The path only exists in the newer data model
+	ChangeRemoved = "removed" // The path only exists in the older data model
+	ChangeChanged = "changed" // The path has different values
+)
+
+// SnapshotInfo describes a snapshot without its contents
+type SnapshotInfo struct {
+	ID      string       `json:"id"`
+	Label   string       `json:"label"`
+	Created time.Time    `json:"created"`
+	Source  ChangeSource `json:"source"` // Who took the snapshot
+}
+
+// Snapshot is a copy of the whole data model, its model and configuration, taken at a point in time
+type Snapshot struct {
+	SnapshotInfo
+	DataModel json.RawMessage `json:"dataModel"` // The data model as config.json stores it
+}
+
+// SnapshotChange is a difference between two data models
+type SnapshotChange struct {
+	Path     string `json:"path"`               // Path in the data model, e.g. "model/sensors/temp" or "mqtt/broker"
+	Change   string `json:"change"`             // "added", "removed" or "changed"
+	OldValue any    `json:"oldValue,omitempty"` // Value in the older data model
+	NewValue any    `json:"newValue,omitempty"` // Value in the newer data model
+}
+
+// snapshotDirectory returns the directory of the snapshots, in the data directory next to the config file
+func snapshotDirectory() string {
+	return filepath.Join(filepath.Dir(configFilePath()), "data", "snapshots")
+}
+
+// snapshotFile returns the path of a snapshot's file, rejecting IDs that could point outside the directory
+func snapshotFile(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", newError(ErrBadRequest, "invalid snapshot ID '%s'", id)
+	}
+	return filepath.Join(snapshotDirectory(), id+".json"), nil
+}
+
+// createSnapshot saves a snapshot of the data model. Its ID is the time it was taken, made unique if needed.
+func createSnapshot(dataModel *DataModel, label string, source ChangeSource) (SnapshotInfo, error) {
+	content, err := json.Marshal(dataModel)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("error marshaling data model to JSON: %w", err)
+	}
+	if err := os.MkdirAll(snapshotDirectory(), 0755); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	snapshot := Snapshot{SnapshotInfo: SnapshotInfo{Label: label, Created: now, Source: source}, DataModel: content}
+	base := now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		snapshot.ID = base
+		if i > 1 {
+			snapshot.ID += "-" + strconv.Itoa(i)
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return SnapshotInfo{}, fmt.Errorf("error marshaling snapshot to JSON: %w", err)
+		}
+
+		file, err := os.OpenFile(filepath.Join(snapshotDirectory(), snapshot.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return SnapshotInfo{}, fmt.Errorf("error saving snapshot: %w", err)
+		}
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+			return SnapshotInfo{}, fmt.Errorf("error saving snapshot: %w", err)
+		}
+		return snapshot.SnapshotInfo, nil
+	}
+}
+
+// readSnapshot reads the snapshot with the ID
+func readSnapshot(id string) (*Snapshot, error) {
+	file, err := snapshotFile(id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, newError(ErrNotFound, "snapshot '%s' not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot '%s': %w", id, err)
+	}
+	return &snapshot, nil
+}
+
+// listSnapshots returns the snapshots, oldest first
+func listSnapshots() ([]SnapshotInfo, error) {
+	snapshots := []SnapshotInfo{}
+	entries, err := os.ReadDir(snapshotDirectory())
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, found := strings.CutSuffix(entry.Name(), ".json")
+		if !found || entry.IsDir() {
+			continue
+		}
+		snapshot, err := readSnapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot.SnapshotInfo)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.Before(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+// deleteSnapshot deletes the snapshot with the ID
+func deleteSnapshot(id string) error {
+	file, err := snapshotFile(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); errors.Is(err, os.ErrNotExist) {
+		return newError(ErrNotFound, "snapshot '%s' not found", id)
+	} else if err != nil {
+		return fmt.Errorf("error deleting snapshot: %w", err)
+	}
+	return nil
+}
+
+// dataModel parses the snapshot's contents into a new data model
+func (s *Snapshot) dataModel() (*DataModel, error) {
+	dataModel := NewDataModel()
+	if err := json.Unmarshal(s.DataModel, dataModel); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot '%s': %w", s.ID, err)
+	}
+	return dataModel, nil
+}
+
+// plainJSON converts a value into the plain JSON types a diff compares
+func plainJSON(value any) (any, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var plain any
+	err = json.Unmarshal(content, &plain)
+	return plain, err
+}
+
+// diffValues appends the differences between the values at the path to the changes. Objects are compared
+// key by key, anything else as a whole.
+func diffValues(path string, oldValue, newValue any, changes []SnapshotChange) []SnapshotChange {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, SnapshotChange{Path: path, Change: ChangeChanged, OldValue: oldValue, NewValue: newValue})
+		}
+		return changes
+	}
+
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "/" + key
+		}
+		oldKeyValue, inOld := oldMap[key]
+		newKeyValue, inNew := newMap[key]
+		switch {
+		case !inOld:
+			changes = append(changes, SnapshotChange{Path: keyPath, Change: ChangeAdded, NewValue: newKeyValue})
+		case !inNew:
+			changes = append(changes, SnapshotChange{Path: keyPath, Change: ChangeRemoved, OldValue: oldKeyValue})
+		default:
+			changes = diffValues(keyPath, oldKeyValue, newKeyValue, changes)
+		}
+	}
+	return changes
+}
+
+// diffDataModels returns the differences from the older to the newer data model, in their model and configuration
+func diffDataModels(oldModel, newModel *DataModel) ([]SnapshotChange, error) {
+	oldValue, err := plainJSON(oldModel)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling data model to JSON: %w", err)
+	}
+	newValue, err := plainJSON(newModel)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling data model to JSON: %w", err)
+	}
+	return diffValues("", oldValue, newValue, []SnapshotChange{}), nil
+}
+
+// restoreModelPath writes the value a snapshot's model has at the path back to the model and publishes it,
+// or deletes the path if the snapshot doesn't have it. Like a whole restore, the value is stored as it is,
+// since onWrite transformations already converted it before the snapshot was taken. The caller must hold the lock.
+func (d *DataModel) restoreModelPath(snapshotModel map[string]any, path string, source ChangeSource) error {
+	pathTokens := strings.Split(path, "/")
+	if value, found := LookupPath(snapshotModel, pathTokens); found {
+		if err := d.writeModelData(pathTokens, DeepCopyValue(value), source); err != nil {
+			return err
+		}
+		if d.Mqtt != nil {
+			return d.Mqtt.PublishMessage(pathTokens, d.GetModelData)
+		}
+		return nil
+	}
+
+	if _, found := LookupPath(d.Model, pathTokens); !found {
+		return newError(ErrNotFound, "path '%s' is neither in the snapshot nor in the model", path)
+	}
+	if err := d.deleteModelData(pathTokens, source); err != nil {
+		return err
+	}
+	if d.Mqtt == nil {
+		return nil
+	}
+
+	// Mappings beneath the path no longer exist, while those above it publish the value without it
+	var mappings []string
+	for _, mapping := range d.Mqtt.AffectedMappings(path) {
+		if _, err := d.GetModelData(strings.Split(mapping, "/"), false); err == nil {
+			mappings = append(mappings, mapping)
+		}
+	}
+	sortPathsByDepth(mappings)
+	return d.Mqtt.PublishMappings(mappings, d.GetModelData)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", `{"a": 1, "b": {"c": [1, 2]}}`, `{"a": 1, "b": {"c": [1, 2]}}`, `[]`},
+		{"changed leaf", `{"a": 1}`, `{"a": 2}`,
+			`[{"path":"a","change":"changed","oldValue":1,"newValue":2}]`},
+		{"added and removed", `{"a": 1, "b": 2}`, `{"b": 2, "c": 3}`,
+			`[{"path":"a","change":"removed","oldValue":1},{"path":"c","change":"added","newValue":3}]`},
+		{"nested paths", `{"model": {"line": {"speed": 3}}}`, `{"model": {"line": {"speed": 7, "mode": "fast"}}}`,
+			`[{"path":"model/line/mode","change":"added","newValue":"fast"},{"path":"model/line/speed","change":"changed","oldValue":3,"newValue":7}]`},
+		{"arrays compared whole", `{"nodes": {"n": ["a", "b"]}}`, `{"nodes": {"n": ["a", "c"]}}`,
+			`[{"path":"nodes/n","change":"changed","oldValue":["a","b"],"newValue":["a","c"]}]`},
+		{"object replaced by value", `{"a": {"b": 1}}`, `{"a": 5}`,
+			`[{"path":"a","change":"changed","oldValue":{"b":1},"newValue":5}]`},
+		{"removed subtree", `{"a": {"b": 1, "c": 2}}`, `{}`,
+			`[{"path":"a","change":"removed","oldValue":{"b":1,"c":2}}]`},
+		{"value changed to null", `{"a": 1}`, `{"a": null}`,
+			`[{"path":"a","change":"changed","oldValue":1}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var oldValue, newValue any
+			json.Unmarshal([]byte(tt.old), &oldValue)
+			json.Unmarshal([]byte(tt.new), &newValue)
+
+			got, _ := json.Marshal(diffValues("", oldValue, newValue, []SnapshotChange{}))
+			if string(got) != tt.want {
+				t.Errorf("diffValues() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreModelPath(t *testing.T) {
+	snapshotModel := map[string]any{"temp": map[string]any{"c": 100.0}, "line": map[string]any{"speed": 3.0}}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr *ErrorKind
+	}{
+		{"value is stored without running onWrite", "temp/c", `{"line":{"mode":"fast","speed":7},"temp":{"c":100}}`, nil},
+		{"subtree replaces the live subtree", "line", `{"line":{"speed":3},"temp":{"c":0}}`, nil},
+		{"path missing from the snapshot is deleted", "line/mode", `{"line":{"speed":7},"temp":{"c":0}}`, nil},
+		{"path in neither", "other", ``, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataModel := newTestDataModel(t, `{"model": {"temp": {"c": 0}, "line": {"speed": 7, "mode": "fast"}},
+				"transformations": {"temp/c": {"onWrite": "(self - 32) * 5 / 9"}}}`)
+
+			err := dataModel.restoreModelPath(snapshotModel, tt.path, ChangeSource{Kind: SourceHTTP})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("restoreModelPath(%q) error = %v, want %s", tt.path, err, tt.wantErr.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restoreModelPath(%q) error = %v", tt.path, err)
+			}
+
+			got, _ := json.Marshal(dataModel.Model)
+			if string(got) != tt.want {
+				t.Errorf("model after restoring %q = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotFiles(t *testing.T) {
+	t.Setenv("CONFIG_FILE_PATH", filepath.Join(t.TempDir(), "config.json"))
+	dataModel := newTestDataModel(t, `{"model": {"a": 1}}`)
+
+	first, err := createSnapshot(dataModel, "first", ChangeSource{Kind: SourceHTTP})
+	if err != nil {
+		t.Fatalf("createSnapshot error = %v", err)
+	}
+	second, err := createSnapshot(dataModel, "second", ChangeSource{Kind: SourceHTTP})
+	if err != nil {
+		t.Fatalf("createSnapshot error = %v", err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("snapshots taken in the same second have the same ID '%s'", first.ID)
+	}
+
+	snapshots, err := listSnapshots()
+	if err != nil {
+		t.Fatalf("listSnapshots error = %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Label != "first" || snapshots[1].Label != "second" {
+		t.Errorf("listSnapshots() = %+v, want first and second", snapshots)
+	}
+
+	snapshot, err := readSnapshot(first.ID)
+	if err != nil {
+		t.Fatalf("readSnapshot error = %v", err)
+	}
+	restored, err := snapshot.dataModel()
+	if err != nil {
+		t.Fatalf("dataModel error = %v", err)
+	}
+	if restored.Model["a"] != 1.0 {
+		t.Errorf("restored model = %v, want a = 1", restored.Model)
+	}
+
+	if err := deleteSnapshot(first.ID); err != nil {
+		t.Fatalf("deleteSnapshot error = %v", err)
+	}
+	for _, id := range []string{first.ID, "../config", ""} {
+		if _, err := readSnapshot(id); err == nil {
+			t.Errorf("readSnapshot(%q) succeeded, want an error", id)
+		}
+	}
+}
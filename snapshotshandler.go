@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// SnapshotsHandler handles requests to take, list, compare and restore snapshots of the data model
+func (s *Server) SnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	tokens := extractPathTokens(r.URL.Path, "/snapshots")
+	switch {
+	case len(tokens) == 0 && r.Method == http.MethodGet:
+		snapshots, err := listSnapshots()
+		if err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		sendJSONResponse(w, snapshots, http.StatusOK)
+
+	case len(tokens) == 0 && r.Method == http.MethodPost:
+		s.createSnapshot(w, r)
+
+	case len(tokens) == 1 && r.Method == http.MethodGet:
+		snapshot, err := readSnapshot(tokens[0])
+		if err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		sendJSONResponse(w, snapshot, http.StatusOK)
+
+	case len(tokens) == 1 && r.Method == http.MethodDelete:
+		if err := deleteSnapshot(tokens[0]); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+
+	case len(tokens) == 2 && tokens[1] == "diff" && r.Method == http.MethodGet:
+		s.diffSnapshot(w, r, tokens[0])
+
+	case len(tokens) == 2 && tokens[1] == "restore" && r.Method == http.MethodPost:
+		s.restoreSnapshot(w, r, tokens[0])
+
+	case len(tokens) > 2 || (len(tokens) == 2 && tokens[1] != "diff" && tokens[1] != "restore"):
+		sendErrorResponse(w, r, newError(ErrNotFound, "'%s' not found", r.URL.Path))
+
+	default:
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+	}
+}
+
+// createSnapshot takes a snapshot of the data model with the label in the request
+func (s *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := readJSONBody(w, r)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	request, _ := jsonData.(map[string]any)
+	label, _ := request["label"].(string)
+	if strings.TrimSpace(label) == "" {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid snapshot: 'label' is required"))
+		return
+	}
+
+	info, err := createSnapshot(&s.dataModel, label, httpSource(r))
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+	log.Printf("Took snapshot '%s' labeled '%s'", info.ID, info.Label)
+
+	sendJSONResponse(w, info, http.StatusCreated)
+}
+
+// diffSnapshot compares a snapshot with the snapshot in the "against" parameter, or with the live data model
+func (s *Server) diffSnapshot(w http.ResponseWriter, r *http.Request, id string) {
+	snapshot, err := readSnapshot(id)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+	oldModel, err := snapshot.dataModel()
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	newModel := &s.dataModel
+	if against := r.URL.Query().Get("against"); against != "" && against != "live" {
+		other, err := readSnapshot(against)
+		if err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		if newModel, err = other.dataModel(); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	changes, err := diffDataModels(oldModel, newModel)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+	sendJSONResponse(w, changes, http.StatusOK)
+}
+
+// restoreSnapshot replaces the data model with a snapshot, or only the model path in the "path" parameter
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request, id string) {
+	snapshot, err := readSnapshot(id)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+	dataModel, err := snapshot.dataModel()
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	if path := strings.Trim(r.URL.Query().Get("path"), "/"); path != "" {
+		if err := validateModelPath(path); err != nil {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid restore path: %w", err))
+			return
+		}
+		if err := s.dataModel.restoreModelPath(dataModel.Model, path, httpSource(r)); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		log.Printf("Restored '%s' from snapshot '%s'", path, id)
+	} else {
+		if err := s.replaceDataModel(dataModel, httpSource(r)); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		log.Printf("Restored snapshot '%s'", id)
+	}
+
+	sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+}
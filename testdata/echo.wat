@@ -0,0 +1,15 @@
+;; echo.wasm returns its input, {"self": ..., "parameters": {...}}, as the result.
+;; It's checked in compiled, since building it needs wat2wasm: wat2wasm echo.wat -o echo.wasm
+(module
+  (memory (export "memory") 1)
+  ;; The input always goes at offset 1024
+  (func (export "alloc") (param $size i32) (result i32)
+    i32.const 1024)
+  (func (export "transform") (param $ptr i32) (param $len i32) (result i64)
+    local.get $ptr
+    i64.extend_i32_u
+    i64.const 32
+    i64.shl
+    local.get $len
+    i64.extend_i32_u
+    i64.or))
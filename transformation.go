@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OnErrorPolicy determines what a read returns in place of a transformation that fails
+type OnErrorPolicy string
+
+const (
+	OnErrorNull      OnErrorPolicy = "null"      // Return null (the default)
+	OnErrorOmit      OnErrorPolicy = "omit"      // Leave the key out of the result
+	OnErrorLast      OnErrorPolicy = "last"      // Return the last value that was successfully calculated
+	OnErrorFallback  OnErrorPolicy = "fallback"  // Return the transformation's "fallback" value
+	OnErrorPropagate OnErrorPolicy = "propagate" // Fail the whole read
+)
+
+// Transformation is the parsed form of an entry in DataModel.Transformations
+type Transformation struct {
+	Implementation string            // Script evaluated when the path is read
+	Parameters     map[string]string // key: variable name, value: model path
+	OnWrite        string            // Script evaluated on values written to the path
+	Engine         string            // Name of the TransformEngine running the scripts, empty for the default
+	Limits         ScriptLimits      // Resource limits for each evaluation of the scripts
+	OnError        OnErrorPolicy     // What reads return when the implementation fails
+	Fallback       any               // Value returned on failure with the fallback policy
+	Schedule       string            // Interval or cron expression for evaluating periodically into the model
+	AllowWrites    bool              // Whether scripts may use model.set and mqtt.publish
+}
+
+// parseTransformation converts a raw transformation from the config into a Transformation
+func parseTransformation(transformationAny any) (*Transformation, error) {
+	// Cast the transformation to the expected format
+	transformationMap, ok := transformationAny.(map[string]any)
+	if !ok {
+		return nil, newError(ErrBadRequest, "invalid transformation format: must be an object")
+	}
+
+	transformation := &Transformation{
+		Parameters: make(map[string]string),
+	}
+
+	// Extract implementation and onWrite scripts
+	if implementation, exists := transformationMap["implementation"]; exists {
+		if transformation.Implementation, ok = implementation.(string); !ok {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'implementation' must be a string")
+		}
+	}
+	if onWrite, exists := transformationMap["onWrite"]; exists {
+		if transformation.OnWrite, ok = onWrite.(string); !ok {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'onWrite' must be a string")
+		}
+	}
+	if engine, exists := transformationMap["engine"]; exists {
+		if transformation.Engine, ok = engine.(string); !ok {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'engine' must be a string")
+		}
+	}
+	if transformation.Implementation == "" && transformation.OnWrite == "" {
+		return nil, newError(ErrBadRequest, "invalid transformation format: missing or invalid 'implementation' field")
+	}
+
+	// Extract the error policy
+	if onError, exists := transformationMap["onError"]; exists {
+		policy, ok := onError.(string)
+		switch OnErrorPolicy(policy) {
+		case OnErrorNull, OnErrorOmit, OnErrorLast, OnErrorFallback, OnErrorPropagate:
+			transformation.OnError = OnErrorPolicy(policy)
+		default:
+			if !ok {
+				policy = fmt.Sprint(onError)
+			}
+			return nil, newError(ErrBadRequest, "invalid transformation format: unknown 'onError' policy '%s'", policy)
+		}
+	}
+	transformation.Fallback = transformationMap["fallback"]
+
+	// Extract the schedule
+	if schedule, exists := transformationMap["schedule"]; exists {
+		if transformation.Schedule, ok = schedule.(string); !ok {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'schedule' must be a string")
+		}
+		if _, err := parseSchedule(transformation.Schedule); err != nil {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'schedule': %w", err)
+		}
+		if transformation.Implementation == "" {
+			return nil, newError(ErrBadRequest, "invalid transformation format: scheduled transformations need an 'implementation'")
+		}
+	}
+
+	// Extract the write permission
+	if allowWrites, exists := transformationMap["allowWrites"]; exists {
+		if transformation.AllowWrites, ok = allowWrites.(bool); !ok {
+			return nil, newError(ErrBadRequest, "invalid transformation format: 'allowWrites' must be a boolean")
+		}
+	}
+
+	// Extract resource limits
+	if limits, ok := transformationMap["limits"].(map[string]any); ok {
+		if timeout, ok := limits["timeout"].(string); ok {
+			duration, err := time.ParseDuration(timeout)
+			if err != nil {
+				return nil, newError(ErrBadRequest, "invalid transformation format: 'limits.timeout': %w", err)
+			}
+			transformation.Limits.Timeout = duration
+		}
+		if memoryPages, ok := limits["memoryPages"].(float64); ok {
+			transformation.Limits.MemoryPages = uint32(memoryPages)
+		}
+	}
+
+	// Extract parameters
+	if params, ok := transformationMap["parameters"].(map[string]any); ok {
+		for k, v := range params {
+			if strVal, ok := v.(string); ok {
+				transformation.Parameters[k] = strVal
+			} else {
+				return nil, newError(ErrBadRequest, "invalid transformation format: parameter '%s' must be a string", k)
+			}
+		}
+	}
+
+	return transformation, nil
+}
+
+// getTransformation looks up and parses the transformation for a path, returning nil if there is none
+func (d *DataModel) getTransformation(path string) (*Transformation, error) {
+	transformationAny, exists := d.Transformations[path]
+	if !exists {
+		return nil, nil
+	}
+
+	transformation, err := parseTransformation(transformationAny)
+	if err != nil {
+		return nil, fmt.Errorf("transformation for path '%s': %w", path, err)
+	}
+
+	return transformation, nil
+}
+
+// validateModelPath checks that a /-separated path refers to a location within the model
+func validateModelPath(path string) error {
+	if path == "" {
+		return fmt.Errorf("path must not be empty")
+	}
+	for _, token := range strings.Split(path, "/") {
+		if token == "" {
+			return fmt.Errorf("path '%s' contains an empty element", path)
+		}
+	}
+	return nil
+}
+
+// ValidateTransformation checks that a transformation can be used at the path: its format, its engine,
+// the syntax of its scripts, and that its parameters refer to valid paths that don't depend on itself
+func ValidateTransformation(path string, transformationAny any) error {
+	if err := validateModelPath(path); err != nil {
+		return newError(ErrBadRequest, "invalid transformation: %w", err)
+	}
+
+	transformation, err := parseTransformation(transformationAny)
+	if err != nil {
+		return err
+	}
+
+	engine, err := getEngine(transformation.Engine)
+	if err != nil {
+		return newError(ErrBadRequest, "invalid transformation: %w", err)
+	}
+
+	scripts := map[string]string{
+		"implementation": transformation.Implementation,
+		"onWrite":        transformation.OnWrite,
+	}
+	for field, script := range scripts {
+		if script == "" {
+			continue
+		}
+		if err := engine.Check(script); err != nil {
+			return newError(ErrBadRequest, "invalid transformation: '%s': %w", field, err)
+		}
+	}
+
+	for paramName, paramPath := range transformation.Parameters {
+		if err := validateModelPath(paramPath); err != nil {
+			return newError(ErrBadRequest, "invalid transformation: parameter '%s': %w", paramName, err)
+		}
+		// Reading the transformation's own path or one of its parents would evaluate the transformation itself
+		if isSubPath(path, paramPath) {
+			return newError(ErrBadRequest, "invalid transformation: parameter '%s' at path '%s' depends on the transformation itself",
+				paramName, paramPath)
+		}
+	}
+
+	return nil
+}
+
+// SetTransformation validates and adds or replaces the transformation at the path
+func (d *DataModel) SetTransformation(path string, transformationAny any) error {
+	if err := ValidateTransformation(path, transformationAny); err != nil {
+		return err
+	}
+
+	if d.Transformations == nil {
+		d.Transformations = make(map[string]any)
+	}
+	d.Transformations[path] = transformationAny
+	d.InvalidatePath(path)
+	d.versions.changed(path)
+
+	return nil
+}
+
+// DeleteTransformation removes the transformation at the path
+func (d *DataModel) DeleteTransformation(path string) error {
+	if _, exists := d.Transformations[path]; !exists {
+		return newError(ErrNotFound, "transformation '%s' not found", path)
+	}
+
+	d.InvalidatePath(path)
+	delete(d.Transformations, path)
+	delete(d.dynamicDependencies, path)
+	d.diagnostics.remove(path)
+	d.versions.changed(path)
+
+	return nil
+}
+
+// SetNode validates and adds or replaces the paths associated with a node
+func (d *DataModel) SetNode(name string, paths []string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return newError(ErrBadRequest, "invalid node: name '%s' must be a single non-empty path element", name)
+	}
+	// Like the node endpoint, ignore a leading "/" so paths from the configuration file are accepted as they are
+	for _, path := range paths {
+		if err := validateModelPath(strings.TrimPrefix(path, "/")); err != nil {
+			return newError(ErrBadRequest, "invalid node: %w", err)
+		}
+	}
+
+	if d.Nodes == nil {
+		d.Nodes = make(map[string][]string)
+	}
+	d.Nodes[name] = paths
+
+	return nil
+}
+
+// DeleteNode removes a node
+func (d *DataModel) DeleteNode(name string) error {
+	if _, exists := d.Nodes[name]; !exists {
+		return newError(ErrNotFound, "node '%s' not found", name)
+	}
+
+	delete(d.Nodes, name)
+
+	return nil
+}
+
+// isSubPath reports whether path is equal to or nested beneath parent
+func isSubPath(path, parent string) bool {
+	if parent == "" || path == parent {
+		return true
+	}
+	return strings.HasPrefix(path, parent+"/")
+}
+
+// pathsOverlap reports whether one of the paths is equal to or nested beneath the other
+func pathsOverlap(a, b string) bool {
+	return isSubPath(a, b) || isSubPath(b, a)
+}
+
+// sortPathsByDepth sorts paths so that parents come before their children
+func sortPathsByDepth(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		depthI, depthJ := strings.Count(paths[i], "/"), strings.Count(paths[j], "/")
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// ConsoleEntry is a message written by a script using console.log/info/warn/error
+type ConsoleEntry struct {
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// TransformationTestResult is the outcome of evaluating a transformation with TestTransformation
+type TransformationTestResult struct {
+	Result     any            `json:"result"`
+	Console    []ConsoleEntry `json:"console"`
+	DurationMs float64        `json:"durationMs"`
+	Error      *ScriptError   `json:"error,omitempty"`
+}
+
+// TestTransformation evaluates a transformation's implementation without adding it to the model.
+// "self" is read from the model at path unless selfOverride is given, and parameters present in
+// overrides use the given value instead of being resolved from the model.
+func (d *DataModel) TestTransformation(transformation *Transformation, path string, selfOverride *any, overrides map[string]any) TransformationTestResult {
+	result := TransformationTestResult{Console: []ConsoleEntry{}}
+
+	fail := func(err error) TransformationTestResult {
+		var scriptErr *ScriptError
+		if errors.As(err, &scriptErr) {
+			// Keep the context of the error while reporting the location
+			result.Error = &ScriptError{Message: err.Error(), Line: scriptErr.Line, Column: scriptErr.Column}
+		} else {
+			result.Error = &ScriptError{Message: err.Error()}
+		}
+		return result
+	}
+
+	engine, err := getEngine(transformation.Engine)
+	if err != nil {
+		return fail(err)
+	}
+
+	var selfValue any
+	if selfOverride != nil {
+		selfValue = *selfOverride
+	} else if path != "" {
+		selfValue, _ = GetMapData(&d.Model, strings.Split(path, "/"))
+	}
+
+	input, err := d.newScriptInput(transformation, transformation.Implementation, selfValue, overrides)
+	if err != nil {
+		return fail(err)
+	}
+	input.Console = func(level, message string) {
+		result.Console = append(result.Console, ConsoleEntry{Level: level, Message: message, Time: time.Now()})
+	}
+	input.Host = &transformationHost{
+		dataModel: d,
+		path:      path,
+		testing:   true,
+		reads:     make(map[string]bool),
+	}
+
+	start := time.Now()
+	value, err := engine.Run(input)
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Result = value
+	return result
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// persistIfRequested saves the data model to the config file if the request has "persist=y" in its query
+func (s *Server) persistIfRequested(r *http.Request) error {
+	if r.URL.Query().Get("persist") != "y" {
+		return nil
+	}
+
+	if err := SaveDataModel(s.dataModel); err != nil {
+		return fmt.Errorf("error saving data model: %w", err)
+	}
+	return nil
+}
+
+// TransformationsHandler handles requests to the transformations endpoint
+func (s *Server) TransformationsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s request to %s", r.Method, r.URL.Path)
+
+	path := strings.Join(extractPathTokens(r.URL.Path, "/transformations"), "/")
+
+	if path == "test" && r.Method == http.MethodPost {
+		s.testTransformation(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if path == "" {
+			sendJSONResponse(w, s.dataModel.Transformations, http.StatusOK)
+			return
+		}
+
+		transformation, exists := s.dataModel.Transformations[path]
+		if !exists {
+			sendErrorResponse(w, r, newError(ErrNotFound, "transformation '%s' not found", path))
+			return
+		}
+
+		sendJSONResponse(w, transformation, http.StatusOK)
+
+	case http.MethodPut:
+		jsonData, err := readJSONBody(w, r)
+		if err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		oldTransformation := s.dataModel.Transformations[path]
+		if err := s.dataModel.SetTransformation(path, jsonData); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		s.scheduler.Restart()
+		s.dataModel.audit.record(AuditEntry{Time: time.Now(), Action: "config", Sections: []string{"transformations"},
+			Path: path, OldValue: oldTransformation, NewValue: s.dataModel.Transformations[path], Source: httpSource(r)})
+
+		if err := s.persistIfRequested(r); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+
+	case http.MethodDelete:
+		oldTransformation := s.dataModel.Transformations[path]
+		if err := s.dataModel.DeleteTransformation(path); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+		s.scheduler.Restart()
+		s.dataModel.audit.record(AuditEntry{Time: time.Now(), Action: "config", Sections: []string{"transformations"},
+			Path: path, OldValue: oldTransformation, Source: httpSource(r)})
+
+		if err := s.persistIfRequested(r); err != nil {
+			sendErrorResponse(w, r, err)
+			return
+		}
+
+		sendJSONResponse(w, map[string]string{"status": "success"}, http.StatusOK)
+
+	default:
+		sendErrorResponse(w, r, newError(ErrMethodNotAllowed, "method %s not supported", r.Method))
+	}
+}
+
+// testTransformation evaluates the transformation in the request body and responds with the outcome.
+//
+// Along with the usual transformation fields, the body may contain "path" to read "self" from the
+// model, "self" to provide it directly, and "values" to provide parameter values by name.
+func (s *Server) testTransformation(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := readJSONBody(w, r)
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	request, ok := jsonData.(map[string]any)
+	if !ok {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid JSON format: expected an object"))
+		return
+	}
+
+	transformation, err := parseTransformation(request)
+	if err != nil {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid JSON format: %w", err))
+		return
+	}
+	if transformation.Implementation == "" {
+		sendErrorResponse(w, r, newError(ErrBadRequest, "invalid JSON format: missing 'implementation' field"))
+		return
+	}
+
+	path, _ := request["path"].(string)
+
+	var selfOverride *any
+	if selfValue, exists := request["self"]; exists {
+		selfOverride = &selfValue
+	}
+
+	overrides, _ := request["values"].(map[string]any)
+
+	result := s.dataModel.TestTransformation(transformation, path, selfOverride, overrides)
+	sendJSONResponse(w, result, http.StatusOK)
+}
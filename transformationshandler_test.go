@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// configStep is a request to a configuration endpoint, made in order with the other steps of a test
+type configStep struct {
+	method     string
+	target     string
+	body       string
+	wantStatus int
+	want       string // JSON of the response body of successful GETs
+}
+
+// runConfigSteps makes the requests in order against the handler
+func runConfigSteps(t *testing.T, handler http.HandlerFunc, steps []configStep) {
+	t.Helper()
+	for i, step := range steps {
+		r := httptest.NewRequest(step.method, step.target, strings.NewReader(step.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != step.wantStatus {
+			t.Fatalf("step %d: %s %s status = %d, want %d: %s", i, step.method, step.target, w.Code, step.wantStatus, w.Body)
+		}
+		if step.want == "" {
+			continue
+		}
+		var got any
+		json.Unmarshal(w.Body.Bytes(), &got)
+		gotJson, _ := json.Marshal(got)
+		if string(gotJson) != step.want {
+			t.Errorf("step %d: %s %s = %s, want %s", i, step.method, step.target, gotJson, step.want)
+		}
+	}
+}
+
+func TestTransformationsHandler(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"line": {"speed": 3}}, "transformations": {
+		"line/double": {"implementation": "speed * 2", "parameters": {"speed": "line/speed"}}}}`)
+	server := CreateServer(*dataModel)
+	defer server.scheduler.Stop()
+
+	runConfigSteps(t, server.TransformationsHandler, []configStep{
+		{http.MethodGet, "/transformations/line/double", "", http.StatusOK,
+			`{"implementation":"speed * 2","parameters":{"speed":"line/speed"}}`},
+		{http.MethodGet, "/transformations/line/missing", "", http.StatusNotFound, ""},
+		{http.MethodPut, "/transformations/line/triple", `{"implementation": "self * 3"}`, http.StatusOK, ""},
+		{http.MethodGet, "/transformations/line/triple", "", http.StatusOK, `{"implementation":"self * 3"}`},
+		{http.MethodGet, "/transformations", "", http.StatusOK,
+			`{"line/double":{"implementation":"speed * 2","parameters":{"speed":"line/speed"}},"line/triple":{"implementation":"self * 3"}}`},
+		{http.MethodPut, "/transformations/line/double", `{"implementation": "speed * 4", "parameters": {"speed": "line/speed"}}`,
+			http.StatusOK, ""},
+		{http.MethodGet, "/transformations/line/double", "", http.StatusOK,
+			`{"implementation":"speed * 4","parameters":{"speed":"line/speed"}}`},
+
+		// Invalid transformations are rejected and leave the previous one in place
+		{http.MethodPut, "/transformations/line/double", `{"implementation": "speed *"}`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/transformations/line/double", `{"implementation": "self", "engine": "cobol"}`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/transformations/line/double", `{"implementation": "p", "parameters": {"p": "line"}}`,
+			http.StatusBadRequest, ""},
+		{http.MethodPut, "/transformations/line/double", `"speed * 2"`, http.StatusBadRequest, ""},
+		{http.MethodGet, "/transformations/line/double", "", http.StatusOK,
+			`{"implementation":"speed * 4","parameters":{"speed":"line/speed"}}`},
+
+		{http.MethodDelete, "/transformations/line/triple", "", http.StatusOK, ""},
+		{http.MethodGet, "/transformations/line/triple", "", http.StatusNotFound, ""},
+		{http.MethodDelete, "/transformations/line/triple", "", http.StatusNotFound, ""},
+		{http.MethodPost, "/transformations/line/double", "{}", http.StatusMethodNotAllowed, ""},
+	})
+
+	// The model follows the changed transformations
+	if value, err := dataModel.GetModelData([]string{"line", "double"}, false); err != nil || value != 12.0 {
+		t.Errorf("line/double = %v (error %v), want 12", value, err)
+	}
+}
+
+func TestNodesHandler(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {}, "nodes": {"sales": ["/sales/north", "sales/south"]}}`)
+	server := CreateServer(*dataModel)
+
+	runConfigSteps(t, server.NodesHandler, []configStep{
+		{http.MethodGet, "/nodes/sales", "", http.StatusOK, `["/sales/north","sales/south"]`},
+		{http.MethodGet, "/nodes/missing", "", http.StatusNotFound, ""},
+
+		// Paths from the configuration file can be put back unchanged
+		{http.MethodPut, "/nodes/sales", `["/sales/north", "sales/south", "/sales/east"]`, http.StatusOK, ""},
+		{http.MethodGet, "/nodes/sales", "", http.StatusOK, `["/sales/north","sales/south","/sales/east"]`},
+		{http.MethodPut, "/nodes/line", `["line/speed"]`, http.StatusOK, ""},
+		{http.MethodGet, "/nodes", "", http.StatusOK, `{"line":["line/speed"],"sales":["/sales/north","sales/south","/sales/east"]}`},
+
+		// Invalid nodes are rejected and leave the previous one in place
+		{http.MethodPut, "/nodes/sales", `["sales//north"]`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/nodes/sales", `["/"]`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/nodes/sales", `["sales/north", 3]`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/nodes/sales", `{"path": "sales/north"}`, http.StatusBadRequest, ""},
+		{http.MethodPut, "/nodes/sales/north", `["sales/north"]`, http.StatusBadRequest, ""},
+		{http.MethodGet, "/nodes/sales", "", http.StatusOK, `["/sales/north","sales/south","/sales/east"]`},
+
+		{http.MethodDelete, "/nodes/line", "", http.StatusOK, ""},
+		{http.MethodGet, "/nodes/line", "", http.StatusNotFound, ""},
+		{http.MethodDelete, "/nodes/line", "", http.StatusNotFound, ""},
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// staleCheckInterval is how often values are checked for exceeding their maximum age
+const staleCheckInterval = time.Second
+
+// Replacements of values that become stale
+const (
+	ReplaceWithLast    = "last"    // Keep the last value
+	ReplaceWithNull    = "null"    // Replace the value with null
+	ReplaceWithDefault = "default" // Replace the value with the rule's default
+)
+
+// TtlRule marks the values at paths matching its globs as stale once they haven't been written for maxAge
+type TtlRule struct {
+	Paths       []string `json:"paths"`                 // Globs of model paths, e.g. "sensors/**"
+	MaxAge      string   `json:"maxAge"`                // How long values stay fresh after they are written, e.g. "30s"
+	Replacement string   `json:"replacement,omitempty"` // "last" (default), "null" or "default"
+	Default     any      `json:"default,omitempty"`     // Value stale values are replaced with if the replacement is "default"
+}
+
+// ttlRule is a TtlRule with its maximum age parsed
+type ttlRule struct {
+	TtlRule
+	maxAge time.Duration
+}
+
+// parseTtlRules checks the rules and parses their maximum ages
+func parseTtlRules(rules []TtlRule) ([]ttlRule, error) {
+	parsed := make([]ttlRule, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Paths) == 0 {
+			return nil, newError(ErrBadRequest, "invalid ttl rule %d: 'paths' is required", i)
+		}
+		maxAge, err := time.ParseDuration(rule.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return nil, newError(ErrBadRequest, "invalid ttl rule %d: 'maxAge' must be a positive duration like \"30s\"", i)
+		}
+		switch rule.Replacement {
+		case "", ReplaceWithLast, ReplaceWithNull, ReplaceWithDefault:
+		default:
+			return nil, newError(ErrBadRequest, "invalid ttl rule %d: unknown 'replacement' '%s', expected 'last', 'null' or 'default'",
+				i, rule.Replacement)
+		}
+		parsed = append(parsed, ttlRule{TtlRule: rule, maxAge: maxAge})
+	}
+	return parsed, nil
+}
+
+// matchTtlRule returns the rule with the shortest maximum age matching the path
+func matchTtlRule(rules []ttlRule, path string) (ttlRule, bool) {
+	var match ttlRule
+	found := false
+	for _, rule := range rules {
+		if found && rule.maxAge >= match.maxAge {
+			continue
+		}
+		for _, pattern := range rule.Paths {
+			if matchPathGlob(pattern, path) {
+				match, found = rule, true
+				break
+			}
+		}
+	}
+	return match, found
+}
+
+// startTtlClocks gives the values that the rules apply to but that have never been written, like those from
+// config.json, metadata as if they had been written now, so that they become stale if they aren't updated
+func (d *DataModel) startTtlClocks(rules []ttlRule) {
+	now := time.Now()
+	WalkLeaves("", d.Model, func(path string, _ any) {
+		if _, ok := d.metadata.get(path); !ok {
+			if _, matched := matchTtlRule(rules, path); matched {
+				d.metadata.values[path] = ValueMetadata{Updated: now, Source: SourceConfig, Quality: QualityGood}
+			}
+		}
+	})
+}
+
+// expireStaleValues marks the values that exceeded the maximum age of their rule as stale and replaces them
+// as configured. Like a write, this invalidates the transformations depending on them, notifies watchers,
+// is audited and, if the value was replaced, publishes it. The caller must hold the lock.
+func (d *DataModel) expireStaleValues(rules []ttlRule, now time.Time) error {
+	var expired []string
+	for path, metadata := range d.metadata.values {
+		if metadata.Quality == QualityStale {
+			continue
+		}
+		if rule, ok := matchTtlRule(rules, path); ok && now.Sub(metadata.Updated) >= rule.maxAge {
+			expired = append(expired, path)
+		}
+	}
+	sort.Strings(expired)
+
+	affectedMappings := make(map[string]bool)
+	for _, path := range expired {
+		rule, _ := matchTtlRule(rules, path)
+		pathTokens := strings.Split(path, "/")
+		oldValue, _ := LookupPath(d.Model, pathTokens)
+
+		metadata, _ := d.metadata.get(path)
+		metadata.Quality = QualityStale
+		d.metadata.values[path] = metadata
+
+		entry := AuditEntry{Time: now, Action: "stale", Path: path, OldValue: oldValue, Source: ChangeSource{Kind: SourceTtl}}
+		if rule.Replacement == ReplaceWithNull || rule.Replacement == ReplaceWithDefault {
+			var replacement any
+			if rule.Replacement == ReplaceWithDefault {
+				replacement = DeepCopyValue(rule.Default)
+			}
+			if err := SetMapData(&d.Model, pathTokens, replacement); err != nil {
+				return fmt.Errorf("error replacing stale value of '%s': %w", path, err)
+			}
+			entry.NewValue = replacement
+			d.history.record(path, replacement, now)
+
+			if d.Mqtt != nil {
+				for _, mapping := range d.Mqtt.AffectedMappings(path) {
+					affectedMappings[mapping] = true
+				}
+			}
+		}
+
+		d.InvalidatePath(path)
+		d.versions.changed(path)
+		d.audit.record(entry)
+		log.Printf("Value of '%s' is stale, it wasn't updated for %s", path, rule.MaxAge)
+	}
+
+	if len(affectedMappings) == 0 {
+		return nil
+	}
+
+	mappings := make([]string, 0, len(affectedMappings))
+	for mapping := range affectedMappings {
+		mappings = append(mappings, mapping)
+	}
+	sortPathsByDepth(mappings)
+
+	return d.Mqtt.PublishMappings(mappings, d.GetModelData)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTtlRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    TtlRule
+		wantErr bool
+	}{
+		{"valid", TtlRule{Paths: []string{"sensors/**"}, MaxAge: "30s"}, false},
+		{"valid with replacement", TtlRule{Paths: []string{"a"}, MaxAge: "1m", Replacement: ReplaceWithDefault, Default: 0}, false},
+		{"missing paths", TtlRule{MaxAge: "30s"}, true},
+		{"invalid max age", TtlRule{Paths: []string{"a"}, MaxAge: "soon"}, true},
+		{"zero max age", TtlRule{Paths: []string{"a"}, MaxAge: "0s"}, true},
+		{"unknown replacement", TtlRule{Paths: []string{"a"}, MaxAge: "30s", Replacement: "zero"}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseTtlRules([]TtlRule{tt.rule})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseTtlRules() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchTtlRule(t *testing.T) {
+	rules, err := parseTtlRules([]TtlRule{
+		{Paths: []string{"sensors/**"}, MaxAge: "1m"},
+		{Paths: []string{"sensors/fast/*"}, MaxAge: "5s"},
+		{Paths: []string{"sensors/fast/temp"}, MaxAge: "10s"},
+	})
+	if err != nil {
+		t.Fatalf("parseTtlRules error = %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		wantMaxAge time.Duration
+		wantFound  bool
+	}{
+		{"sensors/temp", time.Minute, true},
+		{"sensors/fast/temp", 5 * time.Second, true},
+		{"sensors/fast/humidity", 5 * time.Second, true},
+		{"setpoints/temp", 0, false},
+	}
+
+	for _, tt := range tests {
+		rule, found := matchTtlRule(rules, tt.path)
+		if found != tt.wantFound || rule.maxAge != tt.wantMaxAge {
+			t.Errorf("matchTtlRule(%q) = %s, %v, want %s, %v", tt.path, rule.maxAge, found, tt.wantMaxAge, tt.wantFound)
+		}
+	}
+}
+
+func TestExpireStaleValues(t *testing.T) {
+	tests := []struct {
+		replacement string
+		want        string
+	}{
+		{ReplaceWithLast, `{"fresh":2,"old":1}`},
+		{ReplaceWithNull, `{"fresh":2,"old":null}`},
+		{ReplaceWithDefault, `{"fresh":2,"old":-1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.replacement, func(t *testing.T) {
+			dataModel := newTestDataModel(t, `{"model": {"sensors": {"old": 1, "fresh": 2}}}`)
+			rules, err := parseTtlRules([]TtlRule{{Paths: []string{"sensors/*"}, MaxAge: "30s", Replacement: tt.replacement, Default: -1.0}})
+			if err != nil {
+				t.Fatalf("parseTtlRules error = %v", err)
+			}
+
+			now := time.Now()
+			dataModel.metadata.values["sensors/old"] = ValueMetadata{Updated: now.Add(-time.Minute), Source: SourceConfig, Quality: QualityGood}
+			dataModel.metadata.values["sensors/fresh"] = ValueMetadata{Updated: now, Source: SourceConfig, Quality: QualityGood}
+
+			if err := dataModel.expireStaleValues(rules, now); err != nil {
+				t.Fatalf("expireStaleValues error = %v", err)
+			}
+
+			got, _ := json.Marshal(dataModel.Model["sensors"])
+			if string(got) != tt.want {
+				t.Errorf("sensors = %s, want %s", got, tt.want)
+			}
+			if metadata, _ := dataModel.metadata.get("sensors/old"); metadata.Quality != QualityStale {
+				t.Errorf("quality of 'sensors/old' = %s, want stale", metadata.Quality)
+			}
+			if metadata, _ := dataModel.metadata.get("sensors/fresh"); metadata.Quality != QualityGood {
+				t.Errorf("quality of 'sensors/fresh' = %s, want good", metadata.Quality)
+			}
+		})
+	}
+}
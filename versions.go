@@ -0,0 +1,94 @@
+package main
+
+import (
+	"time"
+)
+
+// ModelVersion identifies the state of a path in the model
+type ModelVersion struct {
+	Version  uint64    // Increases with every change to the model
+	Modified time.Time // Time of the change
+}
+
+// versionStore records the version at which each path of the model last changed.
+// Like the rest of the data model, it must only be used while holding the data model's lock.
+type versionStore struct {
+	counter uint64
+	changes map[string]ModelVersion // key: changed path, value: version of its most recent change
+	notify  chan struct{}           // Closed and replaced on every change
+}
+
+func newVersionStore() *versionStore {
+	store := &versionStore{notify: make(chan struct{})}
+	store.reset()
+	return store
+}
+
+// changed records a change to the path, waking anyone waiting for changes, and returns its new version
+func (s *versionStore) changed(path string) ModelVersion {
+	s.counter++
+	version := ModelVersion{Version: s.counter, Modified: time.Now()}
+	s.changes[path] = version
+
+	close(s.notify)
+	s.notify = make(chan struct{})
+
+	return version
+}
+
+// nextChange returns a channel that is closed on the next change to the model. Unlike the rest of the store,
+// the channel can be waited on after releasing the data model's lock.
+func (s *versionStore) nextChange() <-chan struct{} {
+	return s.notify
+}
+
+// reset forgets the changes to individual paths and records a change to the whole model,
+// for when the model is replaced. Versions keep increasing so that older versions never match again.
+func (s *versionStore) reset() {
+	s.changes = make(map[string]ModelVersion)
+	s.changed("")
+}
+
+// PathVersion returns the version of the value read at the path: the most recent change to the path, its parents
+// or its children, and for transformed values, to the transformations and the paths they depend on
+func (d *DataModel) PathVersion(path string) ModelVersion {
+	var latest ModelVersion
+	visited := make(map[string]bool)
+	pending := []string{path}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		for changedPath, version := range d.versions.changes {
+			if version.Version > latest.Version && pathsOverlap(changedPath, current) {
+				latest = version
+			}
+		}
+
+		// Transformed values also change when their inputs do
+		for transformPath := range d.Transformations {
+			if !pathsOverlap(transformPath, current) {
+				continue
+			}
+			pending = append(pending, transformPath)
+
+			transformation, err := d.getTransformation(transformPath)
+			if err != nil || transformation == nil {
+				continue
+			}
+			for _, paramPath := range transformation.Parameters {
+				pending = append(pending, paramPath)
+			}
+			for readPath := range d.dynamicDependencies[transformPath] {
+				pending = append(pending, readPath)
+			}
+		}
+	}
+
+	return latest
+}
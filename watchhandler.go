@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// WatchResult is the response to a watch request
+type WatchResult struct {
+	Changed bool   `json:"changed"` // Whether the path changed before the timeout
+	Version uint64 `json:"version"` // Current version of the path, to pass as "since" to the next watch
+	Value   any    `json:"value"`   // New value of the path if it changed, or null
+
+	Meta map[string]ValueMetadata `json:"meta,omitempty"` // Metadata of the values if it changed and ?meta=true
+}
+
+// watchable serves GET requests with ?watch=true using WatchHandler, and all others using the handler.
+// Unlike the handler, WatchHandler must not be synchronized, since it releases the lock while waiting.
+func (s *Server) watchable(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Query().Get("watch") == "true" {
+			s.WatchHandler(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// WatchHandler handles long-polling requests to /model/<path>?watch=true, which wait until the version of
+// the path is newer than "since" (by default its current version) or the timeout elapses
+func (s *Server) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s watch request to %s", r.Method, r.URL.Path)
+
+	pathTokens := extractPathTokens(r.URL.Path, "/model")
+	path := strings.Join(pathTokens, "/")
+
+	timeout := defaultWatchTimeout
+	if timeoutParam := r.URL.Query().Get("timeout"); timeoutParam != "" {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutParam); err != nil || timeout < 0 {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid watch parameter 'timeout': '%s' is not a duration", timeoutParam))
+			return
+		}
+		if timeout > maxWatchTimeout {
+			timeout = maxWatchTimeout
+		}
+	}
+
+	var since uint64
+	sinceParam := r.URL.Query().Get("since")
+	if sinceParam != "" {
+		var err error
+		if since, err = strconv.ParseUint(sinceParam, 10, 64); err != nil {
+			sendErrorResponse(w, r, newError(ErrBadRequest, "invalid watch parameter 'since': '%s' is not a version", sinceParam))
+			return
+		}
+	}
+
+	queryOptions, err := parseQueryOptions(r.URL.Query())
+	if err != nil {
+		sendErrorResponse(w, r, err)
+		return
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	options := ReadOptions{
+		Raw:          r.URL.Query().Get("raw") == "y",
+		InlineErrors: r.URL.Query().Get("errors") == "inline",
+	}
+
+	policy := accessPolicyFromRequest(r)
+	for {
+		s.mu.Lock()
+
+		// The version is determined after reading, once the paths read by the transformations are known
+		value, err := s.dataModel.GetModelDataWithOptions(pathTokens, options)
+		version := s.dataModel.PathVersion(path)
+		nextChange := s.dataModel.versions.nextChange()
+
+		// Clients that may not read the path mustn't learn when it changes, so they are rejected before waiting
+		readable := policy.Allows(http.MethodGet, "/model/"+path)
+		if err == nil {
+			value, readable = policy.FilterReadable(path, value)
+		}
+
+		if sinceParam == "" {
+			// Without a version, wait for the next change from now
+			since, sinceParam = version.Version, strconv.FormatUint(version.Version, 10)
+		}
+		changed := version.Version > since
+
+		// The response is encoded after unlocking, while other writers may change the model the value belongs to
+		var metadata map[string]ValueMetadata
+		if changed && readable && err == nil {
+			value = DeepCopyValue(value)
+			if queryOptions.Meta {
+				metadata = s.dataModel.ReadableMetadata(path, policy)
+			}
+		}
+
+		s.mu.Unlock()
+
+		if !readable {
+			sendErrorResponse(w, r, policy.forbidden(r.Method, r.URL.Path))
+			return
+		}
+
+		if changed {
+			if err != nil {
+				sendErrorResponse(w, r, fmt.Errorf("error getting data: %w", err))
+				return
+			}
+
+			if value, err = queryOptions.apply(value); err != nil {
+				sendErrorResponse(w, r, err)
+				return
+			}
+
+			setVersionHeaders(w, version)
+			if err := sendJSONResponse(w, WatchResult{Changed: true, Version: version.Version, Value: value, Meta: metadata}, http.StatusOK); err != nil {
+				sendErrorResponse(w, r, fmt.Errorf("error encoding response: %w", err))
+			}
+			return
+		}
+
+		select {
+		case <-nextChange:
+			// Something in the model changed, check whether the path did
+		case <-deadline.C:
+			setVersionHeaders(w, version)
+			sendJSONResponse(w, WatchResult{Changed: false, Version: version.Version}, http.StatusOK)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
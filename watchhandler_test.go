@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// watch sends a watch request for the target to the server, and decodes the result if it succeeds
+func watch(t *testing.T, server *Server, target string, policy *AccessPolicy) (int, WatchResult) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if policy != nil {
+		r = withAccessPolicy(r, policy)
+	}
+	w := httptest.NewRecorder()
+	server.WatchHandler(w, r)
+
+	var result WatchResult
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("invalid watch result %s: %v", w.Body, err)
+		}
+	}
+	return w.Code, result
+}
+
+func TestWatchHandler(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"room": {"temp": 20}, "erp": {"secret": 1}},
+		"transformations": {"room/temp": {"implementation": "self * 2"}}}`)
+	server := CreateServer(*dataModel)
+	current := strconv.FormatUint(server.dataModel.PathVersion("room").Version, 10)
+	older := strconv.FormatUint(server.dataModel.PathVersion("room").Version-1, 10)
+	policy := newAccessPolicy([]AclRule{{Roles: []string{"operator"}, Methods: []string{"GET"}, Paths: []string{"/model/room/**"}}},
+		&Principal{Name: "panel", Roles: []string{"operator"}})
+
+	tests := []struct {
+		name        string
+		target      string
+		policy      *AccessPolicy
+		wantStatus  int
+		wantChanged bool
+		wantValue   string
+	}{
+		{"version mismatch responds right away", "/model/room?watch=true&since=" + older, nil,
+			http.StatusOK, true, `{"temp":40}`},
+		{"version match times out", "/model/room?watch=true&timeout=20ms&since=" + current, nil,
+			http.StatusOK, false, `null`},
+		{"no version times out", "/model/room?watch=true&timeout=20ms", nil,
+			http.StatusOK, false, `null`},
+		{"raw", "/model/room?watch=true&raw=y&since=" + older, nil,
+			http.StatusOK, true, `{"temp":20}`},
+		{"readable path", "/model/room/temp?watch=true&since=0", policy,
+			http.StatusOK, true, `40`},
+		{"parent filtered", "/model?watch=true&since=0", policy,
+			http.StatusOK, true, `{"room":{"temp":40}}`},
+		{"forbidden path doesn't wait", "/model/erp?watch=true&timeout=5m", policy,
+			http.StatusForbidden, false, ``},
+		{"forbidden missing path doesn't wait", "/model/erp/other?watch=true&timeout=5m", policy,
+			http.StatusForbidden, false, ``},
+		{"invalid timeout", "/model/room?watch=true&timeout=soon", nil,
+			http.StatusBadRequest, false, ``},
+		{"invalid version", "/model/room?watch=true&since=latest", nil,
+			http.StatusBadRequest, false, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, result := watch(t, server, tt.target, tt.policy)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			value, _ := json.Marshal(result.Value)
+			if result.Changed != tt.wantChanged || string(value) != tt.wantValue {
+				t.Errorf("result = changed %v, value %s, want changed %v, value %s", result.Changed, value, tt.wantChanged, tt.wantValue)
+			}
+			if result.Version != server.dataModel.PathVersion("room").Version {
+				t.Errorf("version = %d, want the current version %d", result.Version, server.dataModel.PathVersion("room").Version)
+			}
+		})
+	}
+}
+
+func TestWatchHandlerWaitsForChange(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"room": {"temp": 20}, "other": 1}}`)
+	server := CreateServer(*dataModel)
+
+	write := func(path string, value any) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if err := server.dataModel.SetModelData([]string{path}, value, ChangeSource{Kind: SourceHTTP}); err != nil {
+			t.Errorf("SetModelData error = %v", err)
+		}
+	}
+
+	done := make(chan WatchResult)
+	go func() {
+		_, result := watch(t, server, "/model/room?watch=true&timeout=5s", nil)
+		done <- result
+	}()
+
+	// Changes to other paths don't end the watch
+	time.Sleep(20 * time.Millisecond)
+	write("other", 2.0)
+	time.Sleep(20 * time.Millisecond)
+	write("room", map[string]any{"temp": 21.0})
+
+	select {
+	case result := <-done:
+		value, _ := json.Marshal(result.Value)
+		if !result.Changed || string(value) != `{"temp":21}` {
+			t.Errorf("result = changed %v, value %s, want the new value", result.Changed, value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't respond to the change")
+	}
+}
+
+func TestWatchHandlerCopiesValue(t *testing.T) {
+	dataModel := newTestDataModel(t, `{"model": {"room": {"temp": 20, "humidity": 40}}}`)
+	server := CreateServer(*dataModel)
+
+	// Writers change the model while watches encode their responses after releasing the lock, which go test -race
+	// reports if the responses share maps with the model
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		for i := 0.0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.mu.Lock()
+			server.dataModel.SetModelData([]string{"room", "temp"}, i, ChangeSource{Kind: SourceHTTP})
+			server.mu.Unlock()
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		for _, target := range []string{"/model/room?watch=true&since=0", "/model/room?watch=true&since=0&raw=y"} {
+			if status, _ := watch(t, server, target, nil); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+		}
+	}
+}